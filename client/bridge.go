@@ -0,0 +1,99 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/imsbhatnagar/mqtt"
+	"github.com/imsbhatnagar/mqtt/topic"
+)
+
+// TopicRewrite maps a subscription on the "from" side of a Bridge to the
+// topic it is republished under on the "to" side. A received message
+// whose topic matches From has the levels matched by From's literal and
+// `+` levels replaced with To, keeping whatever a trailing `#` matched,
+// e.g. From="site/1/sensors/#", To="cloud/site1/sensors" rewrites
+// "site/1/sensors/temp" to "cloud/site1/sensors/temp".
+type TopicRewrite struct {
+	From string
+	To   string
+	Qos  mqtt.QosLevel
+}
+
+// Bridge mirrors every message matching its configured subscriptions from
+// one Client ("downstream", e.g. an edge broker) to another
+// ("upstream", e.g. a cloud broker), rewriting topics along the way. It
+// is a thin layer over two ordinary Clients: Bridge does not own their
+// reconnect behavior, only the forwarding between them once both are
+// connected.
+type Bridge struct {
+	downstream *Client
+	upstream   *Client
+	rewrites   []TopicRewrite
+}
+
+// NewBridge returns a Bridge forwarding from downstream to upstream per
+// rewrites. Connect must already have been called (or be about to be
+// called) on both clients by the caller; NewBridge only wires up message
+// forwarding, via downstream.OnPublish.
+func NewBridge(downstream, upstream *Client, rewrites []TopicRewrite) *Bridge {
+	b := &Bridge{downstream: downstream, upstream: upstream, rewrites: rewrites}
+
+	prevOnPublish := downstream.OnPublish
+	downstream.OnPublish = func(m *mqtt.Publish) {
+		if prevOnPublish != nil {
+			prevOnPublish(m)
+		}
+		b.forward(m)
+	}
+
+	return b
+}
+
+// Start subscribes on the downstream client to every configured
+// rewrite's From filter, so messages begin flowing to forward.
+func (b *Bridge) Start() error {
+	filters := make([]string, len(b.rewrites))
+	qoss := make([]mqtt.QosLevel, len(b.rewrites))
+	for i, rw := range b.rewrites {
+		filters[i] = rw.From
+		qoss[i] = rw.Qos
+	}
+	return b.downstream.Subscribe(filters, qoss)
+}
+
+func (b *Bridge) forward(m *mqtt.Publish) {
+	for _, rw := range b.rewrites {
+		rewritten, ok := rewriteTopic(rw.From, rw.To, m.TopicName)
+		if !ok {
+			continue
+		}
+		b.upstream.Publish(rewritten, m.Header.QosLevel, m.Header.Retain, m.Data)
+		return
+	}
+}
+
+// rewriteTopic reports whether publishedTopic matches the filter from
+// (which may contain `+`/`#` wildcards) and, if so, returns it rewritten
+// by substituting to for the levels that from's literal and `+` levels
+// matched, keeping whatever a trailing `#` matched as a suffix.
+func rewriteTopic(from, to, publishedTopic string) (string, bool) {
+	fromLevels := topic.Levels(from)
+	topicLevels := topic.Levels(publishedTopic)
+
+	for i, level := range fromLevels {
+		if level == "#" {
+			return strings.Join(append(topic.Levels(to), topicLevels[i:]...), "/"), true
+		}
+		if i >= len(topicLevels) {
+			return "", false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return "", false
+		}
+	}
+
+	if len(fromLevels) != len(topicLevels) {
+		return "", false
+	}
+	return to, true
+}
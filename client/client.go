@@ -0,0 +1,544 @@
+// Package client implements a high-level MQTT client on top of the mqtt
+// codec package: automatic reconnect, the QoS 1/2 handshakes, message id
+// assignment, keep-alive pinging, and persistence of in-flight state
+// across reconnects via a pluggable Store.
+package client
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/imsbhatnagar/mqtt"
+)
+
+// Options configures Connect.
+type Options struct {
+	// Network and Addr are passed to net.Dial, e.g. ("tcp", "broker:1883").
+	Network, Addr string
+
+	ClientId     string
+	CleanSession bool
+	KeepAlive    time.Duration
+
+	Username, Password string
+
+	// Will, if non-nil, is sent as the CONNECT's last-will-and-testament.
+	Will *mqtt.Publish
+
+	// Store persists in-flight QoS 1/2 state across reconnects. A nil
+	// Store defaults to an in-memory one; that is only appropriate for
+	// CleanSession or for state that does not need to survive a process
+	// restart.
+	Store Store
+
+	// ReconnectDelay is the initial delay before the reconnect loop
+	// started by Connect retries a dropped
+	// connection, doubling (capped at MaxReconnectDelay) after each
+	// consecutive failure. A zero value defaults to 1 second.
+	ReconnectDelay time.Duration
+	// MaxReconnectDelay caps the backoff. A zero value defaults to 1 minute.
+	MaxReconnectDelay time.Duration
+
+	// Logger receives one line per failed Store Put or Get (a failed Put
+	// does not otherwise surface, since the handshake that triggers it has
+	// no caller to return an error to). Errors from Store.Delete and
+	// Store.All are not logged. A nil Logger discards them.
+	Logger *log.Logger
+}
+
+func (o *Options) logf(format string, args ...any) {
+	if o.Logger != nil {
+		o.Logger.Printf(format, args...)
+	}
+}
+
+func (o *Options) reconnectDelay() time.Duration {
+	if o.ReconnectDelay > 0 {
+		return o.ReconnectDelay
+	}
+	return time.Second
+}
+
+func (o *Options) maxReconnectDelay() time.Duration {
+	if o.MaxReconnectDelay > 0 {
+		return o.MaxReconnectDelay
+	}
+	return time.Minute
+}
+
+// PublishResult is delivered on the channel Publish returns once the
+// message's QoS handshake (if any) has completed, or the connection was
+// lost before it could.
+type PublishResult struct {
+	Err error
+}
+
+// Client is a reconnecting MQTT client. The zero Client is not usable;
+// construct one with New.
+type Client struct {
+	opts Options
+	mu   sync.Mutex
+
+	conn net.Conn
+	// version is the MQTT protocol level this Client connects with; every
+	// packet read after the handshake is decoded as this version, since
+	// the version itself is not part of a packet's fixed header.
+	version uint8
+	waiters map[uint16]chan<- PublishResult
+	nextId  uint16
+	subs    []subscription
+
+	closed  chan struct{}
+	closeMu sync.Once
+
+	// OnPublish, if set, is called for each inbound Publish once its QoS
+	// handshake (if any) permits delivery.
+	OnPublish func(*mqtt.Publish)
+}
+
+type subscription struct {
+	filters []string
+	qoss    []mqtt.QosLevel
+}
+
+var errClosed = errors.New("mqtt/client: client is closed")
+var errNotConnected = errors.New("mqtt/client: not connected")
+var errConnectionLost = errors.New("mqtt/client: connection lost before handshake completed")
+
+// New returns a Client configured by opts, but does not dial; call
+// Connect to start the reconnect loop.
+func New(opts Options) *Client {
+	if opts.Store == nil {
+		opts.Store = NewMemStore()
+	}
+	return &Client{
+		opts:    opts,
+		waiters: make(map[uint16]chan<- PublishResult),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Connect starts the background connect-and-reconnect loop and blocks
+// until the first connection attempt (not necessarily successful)
+// completes, mirroring synchronous-looking connect semantics while still
+// reconnecting transparently afterwards.
+func (c *Client) Connect() error {
+	first := make(chan error, 1)
+	go c.run(first)
+	return <-first
+}
+
+func (c *Client) run(first chan<- error) {
+	delay := c.opts.reconnectDelay()
+	reportFirst := first
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+
+		conn, err := net.Dial(c.opts.Network, c.opts.Addr)
+		if err == nil {
+			err = c.handshake(conn)
+		}
+
+		if reportFirst != nil {
+			reportFirst <- err
+			reportFirst = nil
+		}
+
+		if err != nil {
+			time.Sleep(delay)
+			delay *= 2
+			if max := c.opts.maxReconnectDelay(); delay > max {
+				delay = max
+			}
+			continue
+		}
+		delay = c.opts.reconnectDelay()
+
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
+
+		c.replayPending()
+		c.resubscribe()
+
+		c.readLoop(conn) // Blocks until the connection drops.
+
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+
+		c.failWaiters(errConnectionLost)
+	}
+}
+
+// failWaiters resolves every outstanding Publish waiter with err. The
+// Pending entries they were waiting on remain in the Store and are
+// resent by replayPending on the next successful reconnect; the waiter
+// itself does not get a second result for that resend.
+func (c *Client) failWaiters(err error) {
+	c.mu.Lock()
+	waiters := c.waiters
+	c.waiters = make(map[uint16]chan<- PublishResult)
+	c.mu.Unlock()
+
+	for _, ch := range waiters {
+		ch <- PublishResult{Err: err}
+		close(ch)
+	}
+}
+
+func (c *Client) handshake(conn net.Conn) error {
+	c.version = mqtt.Version4
+	connect := &mqtt.Connect{
+		Header:          mqtt.Header{},
+		ProtocolName:    "MQTT",
+		ProtocolVersion: c.version,
+		CleanSession:    c.opts.CleanSession,
+		ClientId:        c.opts.ClientId,
+		KeepAliveTimer:  uint16(c.opts.KeepAlive / time.Second),
+	}
+	if c.opts.Username != "" {
+		connect.UsernameFlag = true
+		connect.Username = c.opts.Username
+	}
+	if c.opts.Password != "" {
+		connect.PasswordFlag = true
+		connect.Password = c.opts.Password
+	}
+	if c.opts.Will != nil {
+		connect.WillFlag = true
+		connect.WillTopic = c.opts.Will.TopicName
+		connect.WillMessage = string(c.opts.Will.Data)
+		connect.WillQos = c.opts.Will.Header.QosLevel
+		connect.WillRetain = c.opts.Will.Header.Retain
+	}
+
+	if err := connect.Encode(conn); err != nil {
+		conn.Close()
+		return err
+	}
+
+	msg, err := mqtt.DecodeReadVersion(conn, c.version)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	ack, ok := msg.(*mqtt.ConnAck)
+	if !ok {
+		conn.Close()
+		return errors.New("mqtt/client: expected CONNACK")
+	}
+	if ack.ReturnCode != 0 {
+		conn.Close()
+		return errors.New("mqtt/client: connect refused")
+	}
+
+	if c.opts.KeepAlive > 0 {
+		go c.pingLoop(conn)
+	}
+
+	return nil
+}
+
+func (c *Client) pingLoop(conn net.Conn) {
+	ticker := time.NewTicker(c.opts.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			req := &mqtt.PingReq{}
+			if err := req.Encode(conn); err != nil {
+				return
+			}
+		case <-c.closed:
+			return
+		}
+		c.mu.Lock()
+		current := c.conn
+		c.mu.Unlock()
+		if current != conn {
+			return
+		}
+	}
+}
+
+func (c *Client) readLoop(conn net.Conn) {
+	for {
+		msg, err := mqtt.DecodeReadVersion(conn, c.version)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		c.handleMessage(msg)
+	}
+}
+
+func (c *Client) handleMessage(msg mqtt.Message) {
+	switch m := msg.(type) {
+	case *mqtt.PubAck:
+		c.resolve(m.MessageId, nil)
+		c.opts.Store.Delete(PendingOutbound, m.MessageId)
+	case *mqtt.PubRec:
+		// The outbound Publish has done its job; from here a reconnect
+		// must resume the handshake by resending PUBREL, not the
+		// original Publish, so it is not carried over into this entry.
+		if err := c.opts.Store.Put(Pending{Kind: PendingOutbound, MessageId: m.MessageId, AwaitingPubRel: true}); err != nil {
+			c.opts.logf("mqtt/client: store pubrec %d: %v", m.MessageId, err)
+		}
+		rel := &mqtt.PubRel{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+		rel.Header.QosLevel = 1
+		c.write(rel)
+	case *mqtt.PubComp:
+		c.resolve(m.MessageId, nil)
+		c.opts.Store.Delete(PendingOutbound, m.MessageId)
+	case *mqtt.Publish:
+		c.handleInboundPublish(m)
+	case *mqtt.PubRel:
+		if p, ok, err := c.opts.Store.Get(PendingInbound, m.MessageId); err != nil {
+			c.opts.logf("mqtt/client: store get pubrel %d: %v", m.MessageId, err)
+		} else if ok && p.Publish != nil {
+			c.deliver(p.Publish)
+		}
+		c.opts.Store.Delete(PendingInbound, m.MessageId)
+		comp := &mqtt.PubComp{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+		c.write(comp)
+	}
+}
+
+func (c *Client) handleInboundPublish(m *mqtt.Publish) {
+	switch m.Header.QosLevel {
+	case 0:
+		c.deliver(m)
+	case 1:
+		c.deliver(m)
+		ack := &mqtt.PubAck{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+		c.write(ack)
+	case 2:
+		if err := c.opts.Store.Put(Pending{Kind: PendingInbound, MessageId: m.MessageId, Publish: m}); err != nil {
+			c.opts.logf("mqtt/client: store pubrec %d: %v", m.MessageId, err)
+		}
+		rec := &mqtt.PubRec{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+		c.write(rec)
+		// Delivered to OnPublish when the PUBREL arrives, not here,
+		// since the spec forbids delivering an exactly-once message
+		// before the handshake completes.
+	}
+}
+
+func (c *Client) deliver(m *mqtt.Publish) {
+	if c.OnPublish != nil {
+		c.OnPublish(m)
+	}
+}
+
+func (c *Client) resolve(id uint16, err error) {
+	c.mu.Lock()
+	ch, ok := c.waiters[id]
+	delete(c.waiters, id)
+	c.mu.Unlock()
+	if ok {
+		ch <- PublishResult{Err: err}
+		close(ch)
+	}
+}
+
+func (c *Client) write(msg mqtt.Message) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return errNotConnected
+	}
+	return msg.Encode(conn)
+}
+
+// Publish sends a message, assigning a fresh message id if qos > 0. The
+// returned channel receives exactly one PublishResult: nil error once
+// the handshake for that qos completes, or a non-nil error if the
+// connection drops first (the message remains in the Store and will be
+// redelivered with DUP set on the next successful reconnect).
+func (c *Client) Publish(topic string, qos mqtt.QosLevel, retain bool, payload []byte) <-chan PublishResult {
+	result := make(chan PublishResult, 1)
+
+	select {
+	case <-c.closed:
+		result <- PublishResult{Err: errClosed}
+		close(result)
+		return result
+	default:
+	}
+
+	msg := &mqtt.Publish{
+		Header:    mqtt.Header{QosLevel: qos, Retain: retain},
+		TopicName: topic,
+		Data:      payload,
+	}
+
+	if qos == 0 {
+		if err := c.write(msg); err != nil {
+			result <- PublishResult{Err: err}
+			close(result)
+		} else {
+			result <- PublishResult{Err: nil}
+			close(result)
+		}
+		return result
+	}
+
+	c.mu.Lock()
+	id := c.allocId()
+	msg.MessageId = id
+	c.waiters[id] = result
+	c.mu.Unlock()
+
+	if err := c.opts.Store.Put(Pending{Kind: PendingOutbound, MessageId: id, Publish: msg}); err != nil {
+		c.opts.logf("mqtt/client: store publish %d: %v", id, err)
+	}
+
+	if err := c.write(msg); err != nil {
+		// Left in the Store; replayPending resends it once reconnected.
+	}
+
+	return result
+}
+
+// allocId assigns the next outbound message id, wrapping from 0xFFFF
+// back to 1 (0 is reserved) and skipping ids with a waiter still
+// outstanding. Callers must hold c.mu.
+func (c *Client) allocId() uint16 {
+	for {
+		c.nextId++
+		if c.nextId == 0 {
+			c.nextId = 1
+		}
+		if _, outstanding := c.waiters[c.nextId]; !outstanding {
+			return c.nextId
+		}
+	}
+}
+
+// Subscribe subscribes to each filter at the corresponding qos, and
+// remembers the subscription so it is replayed automatically on
+// reconnect (clean or not, since the broker forgets subscriptions across
+// a clean-session reconnect).
+func (c *Client) Subscribe(filters []string, qoss []mqtt.QosLevel) error {
+	c.mu.Lock()
+	c.subs = append(c.subs, subscription{filters: filters, qoss: qoss})
+	id := c.allocId()
+	c.mu.Unlock()
+
+	msg := &mqtt.Subscribe{
+		Header:    mqtt.Header{QosLevel: 1},
+		MessageId: id,
+		Topics:    filters,
+		TopicsQos: qoss,
+	}
+	return c.write(msg)
+}
+
+// Unsubscribe removes filters from the subscription set and asks the
+// broker to stop delivering them.
+func (c *Client) Unsubscribe(filters []string) error {
+	c.mu.Lock()
+	for _, f := range filters {
+		for i, s := range c.subs {
+			s.filters, s.qoss = removeFilter(s.filters, s.qoss, f)
+			c.subs[i] = s
+		}
+	}
+	id := c.allocId()
+	c.mu.Unlock()
+
+	msg := &mqtt.Unsubscribe{
+		Header:    mqtt.Header{QosLevel: 1},
+		MessageId: id,
+		Topics:    filters,
+	}
+	return c.write(msg)
+}
+
+// removeFilter removes every occurrence of v from filters, dropping the
+// corresponding entry of the parallel qoss slice so the two stay
+// aligned for resubscribe.
+func removeFilter(filters []string, qoss []mqtt.QosLevel, v string) ([]string, []mqtt.QosLevel) {
+	outFilters := filters[:0]
+	outQoss := qoss[:0]
+	for i, f := range filters {
+		if f != v {
+			outFilters = append(outFilters, f)
+			outQoss = append(outQoss, qoss[i])
+		}
+	}
+	return outFilters, outQoss
+}
+
+func (c *Client) replayPending() {
+	pending, err := c.opts.Store.All()
+	if err != nil {
+		return
+	}
+	for _, p := range pending {
+		if p.Kind != PendingOutbound {
+			continue
+		}
+		if p.AwaitingPubRel {
+			rel := &mqtt.PubRel{AckCommon: mqtt.AckCommon{MessageId: p.MessageId}}
+			rel.Header.QosLevel = 1
+			c.write(rel)
+			continue
+		}
+		if p.Publish == nil {
+			continue
+		}
+		msg := *p.Publish
+		msg.Header.DupFlag = true
+		c.write(&msg)
+	}
+}
+
+func (c *Client) resubscribe() {
+	c.mu.Lock()
+	subs := append([]subscription(nil), c.subs...)
+	c.mu.Unlock()
+
+	for _, s := range subs {
+		id := func() uint16 {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.allocId()
+		}()
+		msg := &mqtt.Subscribe{
+			Header:    mqtt.Header{QosLevel: 1},
+			MessageId: id,
+			Topics:    s.filters,
+			TopicsQos: s.qoss,
+		}
+		c.write(msg)
+	}
+}
+
+// Disconnect sends a DISCONNECT and stops the reconnect loop. The Client
+// must not be used after Disconnect returns.
+func (c *Client) Disconnect() error {
+	c.closeMu.Do(func() { close(c.closed) })
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+
+	disc := &mqtt.Disconnect{}
+	err := disc.Encode(conn)
+	conn.Close()
+	return err
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/imsbhatnagar/mqtt"
+)
+
+func TestRemoveFilter(t *testing.T) {
+	filters := []string{"a/1", "a/2", "a/3"}
+	qoss := []mqtt.QosLevel{0, 1, 2}
+
+	gotFilters, gotQoss := removeFilter(filters, qoss, "a/2")
+
+	if want := []string{"a/1", "a/3"}; !equalStrings(gotFilters, want) {
+		t.Errorf("filters = %v, want %v", gotFilters, want)
+	}
+	if want := []mqtt.QosLevel{0, 2}; !equalQos(gotQoss, want) {
+		t.Errorf("qoss = %v, want %v", gotQoss, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalQos(a, b []mqtt.QosLevel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClientAllocIdSkipsOutstanding(t *testing.T) {
+	c := New(Options{})
+	c.nextId = 0
+	c.waiters[1] = make(chan<- PublishResult, 1)
+
+	if got := c.allocId(); got != 2 {
+		t.Errorf("allocId() = %d, want 2 (1 is outstanding)", got)
+	}
+}
+
+// fakeBroker reads one CONNECT and replies CONNACK, then hands control to
+// handle for whatever the test wants to do next.
+func fakeBroker(t *testing.T, conn net.Conn, handle func(net.Conn)) {
+	t.Helper()
+	if _, err := mqtt.DecodeRead(conn); err != nil {
+		t.Errorf("fakeBroker: decode CONNECT: %v", err)
+		return
+	}
+	ack := &mqtt.ConnAck{}
+	if err := ack.Encode(conn); err != nil {
+		t.Errorf("fakeBroker: encode CONNACK: %v", err)
+		return
+	}
+	handle(conn)
+}
+
+func TestClientPublishQoS1Acked(t *testing.T) {
+	clientConn, brokerConn := net.Pipe()
+	defer clientConn.Close()
+	defer brokerConn.Close()
+
+	go fakeBroker(t, brokerConn, func(conn net.Conn) {
+		msg, err := mqtt.DecodeRead(conn)
+		if err != nil {
+			t.Errorf("fakeBroker: decode PUBLISH: %v", err)
+			return
+		}
+		pub, ok := msg.(*mqtt.Publish)
+		if !ok {
+			t.Errorf("fakeBroker: got %T, want *mqtt.Publish", msg)
+			return
+		}
+		ack := &mqtt.PubAck{AckCommon: mqtt.AckCommon{MessageId: pub.MessageId}}
+		if err := ack.Encode(conn); err != nil {
+			t.Errorf("fakeBroker: encode PUBACK: %v", err)
+		}
+	})
+
+	c := New(Options{})
+	if err := c.handshake(clientConn); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	c.conn = clientConn
+	go c.readLoop(clientConn)
+
+	result := c.Publish("a/b", 1, false, []byte("hi"))
+
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			t.Errorf("PublishResult.Err = %v, want nil", r.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for PublishResult")
+	}
+}
+
+func TestClientInboundQoS2DeliversOnPubRel(t *testing.T) {
+	c := New(Options{})
+	var delivered *mqtt.Publish
+	c.OnPublish = func(m *mqtt.Publish) { delivered = m }
+
+	pub := &mqtt.Publish{Header: mqtt.Header{QosLevel: 2}, TopicName: "a/b", MessageId: 5, Data: []byte("hi")}
+	c.handleMessage(pub)
+	if delivered != nil {
+		t.Fatal("QoS 2 Publish delivered before its PUBREL arrived")
+	}
+
+	c.handleMessage(&mqtt.PubRel{AckCommon: mqtt.AckCommon{MessageId: 5}})
+	if delivered != pub {
+		t.Errorf("PUBREL did not deliver the stored Publish, got %#v", delivered)
+	}
+}
+
+func TestClientReplayPendingResendsPubRel(t *testing.T) {
+	c := New(Options{})
+	c.handleMessage(&mqtt.PubRec{AckCommon: mqtt.AckCommon{MessageId: 9}})
+
+	pending, err := c.opts.Store.All()
+	if err != nil || len(pending) != 1 || !pending[0].AwaitingPubRel {
+		t.Fatalf("Store after PUBREC = %+v, err=%v, want one AwaitingPubRel entry", pending, err)
+	}
+
+	clientConn, brokerConn := net.Pipe()
+	defer clientConn.Close()
+	defer brokerConn.Close()
+
+	got := make(chan mqtt.Message, 1)
+	go func() {
+		if msg, err := mqtt.DecodeRead(brokerConn); err == nil {
+			got <- msg
+		}
+	}()
+
+	c.conn = clientConn
+	c.replayPending()
+
+	select {
+	case msg := <-got:
+		if rel, ok := msg.(*mqtt.PubRel); !ok || rel.MessageId != 9 {
+			t.Errorf("replayPending sent %#v, want PUBREL for message id 9", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replayPending did not resend PUBREL for the AwaitingPubRel entry")
+	}
+}
+
+func TestClientFailWaitersOnDisconnect(t *testing.T) {
+	c := New(Options{})
+	result := make(chan PublishResult, 1)
+	c.waiters[1] = result
+
+	c.failWaiters(errConnectionLost)
+
+	select {
+	case r := <-result:
+		if r.Err != errConnectionLost {
+			t.Errorf("PublishResult.Err = %v, want errConnectionLost", r.Err)
+		}
+	default:
+		t.Fatal("waiter was not resolved")
+	}
+
+	if len(c.waiters) != 0 {
+		t.Errorf("c.waiters not cleared: %v", c.waiters)
+	}
+}
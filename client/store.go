@@ -0,0 +1,212 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/imsbhatnagar/mqtt"
+)
+
+func init() {
+	// Pending.Publish.Payload is an mqtt.Payload interface; gob refuses
+	// to encode a concrete type behind an interface unless it has been
+	// registered, so a FileStore.Put of any Publish decoded in the
+	// (default) buffered configuration would otherwise fail.
+	gob.Register(&mqtt.BytesPayload{})
+}
+
+// PendingKind distinguishes the two kinds of unresolved exactly-once
+// state a Store has to survive a reconnect: an outbound message this
+// Client has not yet had fully acknowledged, and an inbound QoS 2
+// message this Client has PUBREC'd but not yet received the matching
+// PUBREL for.
+type PendingKind int
+
+const (
+	PendingOutbound PendingKind = iota
+	PendingInbound
+)
+
+// Pending is one in-flight QoS 1/2 message, as persisted by a Store.
+type Pending struct {
+	Kind      PendingKind
+	MessageId uint16
+	Publish   *mqtt.Publish
+	// AwaitingPubRel is set for an outbound QoS 2 Publish that has been
+	// PUBREC'd and is now waiting for the matching PUBREL: on reconnect
+	// it must be resumed by resending PUBREL, not the original Publish.
+	AwaitingPubRel bool
+}
+
+// Store persists the in-flight QoS 1/2 state a Client needs to resume
+// correctly across a reconnect with CleanSession=false: unacknowledged
+// outbound Publishes, and inbound QoS 2 Publishes awaiting their PUBREL.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Put saves or replaces p, keyed by (p.Kind, p.MessageId).
+	Put(p Pending) error
+	// Get returns the entry for (kind, messageId), or ok == false if
+	// there is none.
+	Get(kind PendingKind, messageId uint16) (p Pending, ok bool, err error)
+	// Delete removes the entry for (kind, messageId), if any.
+	Delete(kind PendingKind, messageId uint16) error
+	// All returns every currently-stored entry, in no particular order,
+	// for replay after a reconnect.
+	All() ([]Pending, error)
+}
+
+// MemStore is an in-memory Store. Its contents do not survive a process
+// restart, so it is only useful for a Client run with CleanSession=true,
+// or for testing.
+type MemStore struct {
+	mu      sync.Mutex
+	entries map[storeKey]Pending
+}
+
+type storeKey struct {
+	kind      PendingKind
+	messageId uint16
+}
+
+// NewMemStore returns an empty in-memory Store.
+func NewMemStore() *MemStore {
+	return &MemStore{entries: make(map[storeKey]Pending)}
+}
+
+func (s *MemStore) Put(p Pending) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[storeKey{p.Kind, p.MessageId}] = p
+	return nil
+}
+
+func (s *MemStore) Get(kind PendingKind, messageId uint16) (Pending, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.entries[storeKey{kind, messageId}]
+	return p, ok, nil
+}
+
+func (s *MemStore) Delete(kind PendingKind, messageId uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, storeKey{kind, messageId})
+	return nil
+}
+
+func (s *MemStore) All() ([]Pending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]Pending, 0, len(s.entries))
+	for _, p := range s.entries {
+		all = append(all, p)
+	}
+	return all, nil
+}
+
+// FileStore is a Store that keeps one file per pending entry in a
+// directory, so state survives a process restart. It trades efficiency
+// for simplicity: every Put/Delete does a full file write/remove rather
+// than appending to a log.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore returns a Store backed by files in dir, which is created
+// if it does not already exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(kind PendingKind, messageId uint16) string {
+	prefix := "out"
+	if kind == PendingInbound {
+		prefix = "in"
+	}
+	return filepath.Join(s.dir, prefix+"-"+itoa(messageId))
+}
+
+func (s *FileStore) Put(p Pending) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(p); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(p.Kind, p.MessageId), buf.Bytes(), 0600)
+}
+
+func (s *FileStore) Get(kind PendingKind, messageId uint16) (Pending, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(kind, messageId))
+	if os.IsNotExist(err) {
+		return Pending{}, false, nil
+	}
+	if err != nil {
+		return Pending{}, false, err
+	}
+	var p Pending
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&p); err != nil {
+		return Pending{}, false, err
+	}
+	return p, true, nil
+}
+
+func (s *FileStore) Delete(kind PendingKind, messageId uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(kind, messageId))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) All() ([]Pending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]Pending, 0, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var p Pending
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&p); err != nil {
+			return nil, err
+		}
+		all = append(all, p)
+	}
+	return all, nil
+}
+
+func itoa(v uint16) string {
+	if v == 0 {
+		return "0"
+	}
+	var buf [5]byte
+	i := len(buf)
+	for v > 0 {
+		i--
+		buf[i] = byte('0' + v%10)
+		v /= 10
+	}
+	return string(buf[i:])
+}
@@ -0,0 +1,99 @@
+package mqtt
+
+import "io"
+
+// DecodeRead reads one packet from r, dispatching on its fixed header to
+// the right Message type and decoding the rest of the packet into it, as
+// MQTT version 4 (3.1.1). DecodeRead is equivalent to
+// DecodeReadVersion(r, Version4); a caller that has negotiated a
+// different version over a CONNECT/CONNACK (or is reading a stream where
+// packets may use MQTT5 features such as reason codes or properties)
+// must use DecodeReadVersion instead and carry the negotiated version
+// itself, since it is not part of a packet's fixed header.
+func DecodeRead(r io.Reader) (Message, error) {
+	return DecodeReadVersion(r, Version4)
+}
+
+// DecodeReadVersion reads one packet from r the same way DecodeRead does,
+// decoding it as protocol version version. DecodeReadVersion is
+// equivalent to DecodeReadVersionConfig(r, version, DefaultDecoderConfig).
+func DecodeReadVersion(r io.Reader, version uint8) (Message, error) {
+	return DecodeReadVersionConfig(r, version, DefaultDecoderConfig)
+}
+
+// DecodeReadConfig reads one packet from r the same way DecodeRead does,
+// except that when the packet is a Publish its payload is built with
+// config instead of always being buffered into Publish.Data.
+// DecodeReadConfig is equivalent to
+// DecodeReadVersionConfig(r, Version4, config).
+func DecodeReadConfig(r io.Reader, config DecoderConfig) (Message, error) {
+	return DecodeReadVersionConfig(r, Version4, config)
+}
+
+// DecodeReadVersionConfig combines DecodeReadVersion and
+// DecodeReadConfig: it decodes as protocol version version, and builds a
+// Publish's payload with config instead of always buffering it.
+func DecodeReadVersionConfig(r io.Reader, version uint8, config DecoderConfig) (Message, error) {
+	var hdr Header
+	msgType, packetRemaining, err := hdr.Decode(r, version)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := newMessage(msgType, hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	if publish, ok := msg.(*Publish); ok {
+		err = publish.DecodeConfig(r, hdr, packetRemaining, config)
+	} else {
+		err = msg.Decode(r, hdr, packetRemaining)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// newMessage allocates the zero value of the Message type corresponding
+// to msgType, with its embedded Header already set to hdr so that a
+// Decode method can rely on its own msg.Header instead of the hdr
+// argument it is also passed.
+func newMessage(msgType MessageType, hdr Header) (Message, error) {
+	switch msgType {
+	case MsgConnect:
+		return &Connect{Header: hdr}, nil
+	case MsgConnAck:
+		return &ConnAck{Header: hdr}, nil
+	case MsgPublish:
+		return &Publish{Header: hdr}, nil
+	case MsgPubAck:
+		return &PubAck{AckCommon: AckCommon{Header: hdr}}, nil
+	case MsgPubRec:
+		return &PubRec{AckCommon: AckCommon{Header: hdr}}, nil
+	case MsgPubRel:
+		return &PubRel{AckCommon: AckCommon{Header: hdr}}, nil
+	case MsgPubComp:
+		return &PubComp{AckCommon: AckCommon{Header: hdr}}, nil
+	case MsgSubscribe:
+		return &Subscribe{Header: hdr}, nil
+	case MsgSubAck:
+		return &SubAck{Header: hdr}, nil
+	case MsgUnsubscribe:
+		return &Unsubscribe{Header: hdr}, nil
+	case MsgUnsubAck:
+		return &UnsubAck{AckCommon: AckCommon{Header: hdr}}, nil
+	case MsgPingReq:
+		return &PingReq{Header: hdr}, nil
+	case MsgPingResp:
+		return &PingResp{Header: hdr}, nil
+	case MsgDisconnect:
+		return &Disconnect{Header: hdr}, nil
+	case MsgAuth:
+		return &Auth{Header: hdr}, nil
+	default:
+		return nil, badMsgTypeError
+	}
+}
@@ -2,14 +2,42 @@ package mqtt
 
 import (
 	"bytes"
+	"errors"
 	"io"
+
+	"github.com/imsbhatnagar/mqtt/topic"
 )
 
+var badTopicFilterError = errors.New("mqtt: malformed topic filter")
+
+// StrictTopicValidation, when true, makes Subscribe.Encode and
+// Subscribe.Decode reject a topic filter that is not well-formed per
+// topic.Filter.Valid (e.g. a "#" that is not alone in the final level).
+// It is false by default so that existing callers keep accepting
+// whatever filters they always have.
+var StrictTopicValidation = false
+
 type Header struct {
 	DupFlag, Retain bool
 	QosLevel        QosLevel
+
+	// Version is the MQTT protocol level this packet is encoded/decoded
+	// as: 3 (MQIsdp 3.1), 4 (MQTT 3.1.1) or 5 (MQTT 5.0). It is not part
+	// of the fixed header on the wire; callers decoding a stream of
+	// packets are expected to carry the version learned from the
+	// initial CONNECT (or pass one in explicitly) on every subsequent
+	// Header they hand to a message's Decode method. The zero value
+	// behaves as version 4.
+	Version uint8
 }
 
+// Supported values of Header.Version / Connect.ProtocolVersion.
+const (
+	Version3 = uint8(3)
+	Version4 = uint8(4)
+	Version5 = uint8(5)
+)
+
 func (hdr *Header) Encode(w io.Writer, msgType MessageType, remainingLength int32) error {
 	if !hdr.QosLevel.IsValid() {
 		return badQosError
@@ -29,7 +57,12 @@ func (hdr *Header) Encode(w io.Writer, msgType MessageType, remainingLength int3
 	return err
 }
 
-func (hdr *Header) Decode(r io.Reader) (msgType MessageType, remainingLength int32, err error) {
+// Decode reads one fixed header from r. version is not itself part of the
+// wire format (see the Header.Version doc comment); it is copied onto the
+// returned Header as-is so that a message's own Decode method can make
+// version-dependent decisions, such as Connect's properties block or
+// AckCommon's reason code.
+func (hdr *Header) Decode(r io.Reader, version uint8) (msgType MessageType, remainingLength int32, err error) {
 	defer func() {
 		err = recoverError(err)
 	}()
@@ -44,9 +77,10 @@ func (hdr *Header) Decode(r io.Reader) (msgType MessageType, remainingLength int
 	msgType = MessageType(byte1 & 0xF0 >> 4)
 
 	*hdr = Header{
-		DupFlag:     byte1&0x08 > 0,
-		QosLevel:    QosLevel(byte1 & 0x06 >> 1),
-		Retain:      byte1&0x01 > 0,
+		DupFlag:  byte1&0x08 > 0,
+		QosLevel: QosLevel(byte1 & 0x06 >> 1),
+		Retain:   byte1&0x01 > 0,
+		Version:  version,
 	}
 
 	remainingLength = decodeLength(r)
@@ -74,6 +108,7 @@ const (
 	MsgPingReq
 	MsgPingResp
 	MsgDisconnect
+	MsgAuth
 
 	msgTypeFirstInvalid
 )
@@ -84,8 +119,8 @@ func (mt MessageType) IsValid() bool {
 	return mt >= MsgConnect && mt < msgTypeFirstInvalid
 }
 
-func writeMessage(w io.Writer, hdr *Header, payloadBuf *bytes.Buffer) error {
-	err := hdr.Encode(w, MsgConnect, int32(len(payloadBuf.Bytes())))
+func writeMessage(w io.Writer, hdr *Header, msgType MessageType, payloadBuf *bytes.Buffer) error {
+	err := hdr.Encode(w, msgType, int32(len(payloadBuf.Bytes())))
 	if err != nil {
 		return err
 	}
@@ -108,6 +143,12 @@ type Connect struct {
 	WillTopic, WillMessage     string
 	UsernameFlag, PasswordFlag bool
 	Username, Password         string
+
+	// Properties and WillProperties are only encoded/decoded when
+	// ProtocolVersion is 5 or greater; WillProperties is only present
+	// when WillFlag is set.
+	Properties     *Properties
+	WillProperties *Properties
 }
 
 func (msg *Connect) Encode(w io.Writer) (err error) {
@@ -128,8 +169,14 @@ func (msg *Connect) Encode(w io.Writer) (err error) {
 	setUint8(msg.ProtocolVersion, buf)
 	buf.WriteByte(flags)
 	setUint16(msg.KeepAliveTimer, buf)
+	if msg.ProtocolVersion >= Version5 {
+		msg.Properties.Encode(buf)
+	}
 	setString(msg.ClientId, buf)
 	if msg.WillFlag {
+		if msg.ProtocolVersion >= Version5 {
+			msg.WillProperties.Encode(buf)
+		}
 		setString(msg.WillTopic, buf)
 		setString(msg.WillMessage, buf)
 	}
@@ -140,7 +187,7 @@ func (msg *Connect) Encode(w io.Writer) (err error) {
 		setString(msg.Password, buf)
 	}
 
-	return writeMessage(w, &msg.Header, buf)
+	return writeMessage(w, &msg.Header, MsgConnect, buf)
 }
 
 func (msg *Connect) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
@@ -152,7 +199,6 @@ func (msg *Connect) Decode(r io.Reader, hdr Header, packetRemaining int32) (err
 	protocolVersion := getUint8(r, &packetRemaining)
 	flags := getUint8(r, &packetRemaining)
 	keepAliveTimer := getUint16(r, &packetRemaining)
-	clientId := getString(r, &packetRemaining)
 
 	*msg = Connect{
 		ProtocolName:    protocolName,
@@ -164,10 +210,22 @@ func (msg *Connect) Decode(r io.Reader, hdr Header, packetRemaining int32) (err
 		WillFlag:        flags&0x04 > 0,
 		CleanSession:    flags&0x02 > 0,
 		KeepAliveTimer:  keepAliveTimer,
-		ClientId:        clientId,
 	}
 
+	if protocolVersion >= Version5 {
+		if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+			return err
+		}
+	}
+
+	msg.ClientId = getString(r, &packetRemaining)
+
 	if msg.WillFlag {
+		if protocolVersion >= Version5 {
+			if msg.WillProperties, err = DecodeProperties(r, &packetRemaining); err != nil {
+				return err
+			}
+		}
 		msg.WillTopic = getString(r, &packetRemaining)
 		msg.WillMessage = getString(r, &packetRemaining)
 	}
@@ -183,16 +241,27 @@ func (msg *Connect) Decode(r io.Reader, hdr Header, packetRemaining int32) (err
 
 type ConnAck struct {
 	Header
-	ReturnCode ReturnCode
+	SessionPresent bool
+	ReturnCode     ReturnCode
+
+	// ReasonCode and Properties replace ReturnCode for hdr.Version >= 5;
+	// ReturnCode is left zeroed in that case.
+	ReasonCode ReasonCode
+	Properties *Properties
 }
 
 func (msg *ConnAck) Encode(w io.Writer) (err error) {
 	buf := new(bytes.Buffer)
 
-	buf.WriteByte(byte(0))
-	setUint8(uint8(msg.ReturnCode), buf)
+	setUint8(boolToByte(msg.SessionPresent), buf)
+	if msg.Header.Version >= Version5 {
+		setUint8(uint8(msg.ReasonCode), buf)
+		msg.Properties.Encode(buf)
+	} else {
+		setUint8(uint8(msg.ReturnCode), buf)
+	}
 
-	return writeMessage(w, &msg.Header, buf)
+	return writeMessage(w, &msg.Header, MsgConnAck, buf)
 }
 
 func (msg *ConnAck) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
@@ -200,7 +269,16 @@ func (msg *ConnAck) Decode(r io.Reader, hdr Header, packetRemaining int32) (err
 		err = recoverError(err)
 	}()
 
-	getUint8(r, &packetRemaining) // Skip reserved byte.
+	msg.SessionPresent = getUint8(r, &packetRemaining)&0x01 > 0
+
+	if hdr.Version >= Version5 {
+		msg.ReasonCode = ReasonCode(getUint8(r, &packetRemaining))
+		if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+			return err
+		}
+		return nil
+	}
+
 	msg.ReturnCode = ReturnCode(getUint8(r, &packetRemaining))
 	if !msg.ReturnCode.IsValid() {
 		return badReturnCodeError
@@ -213,7 +291,21 @@ type Publish struct {
 	Header
 	TopicName string
 	MessageId uint16
+
+	// Data holds the payload when Payload is nil. Decode also fills Data
+	// when the payload is a *BytesPayload (the DefaultDecoderConfig
+	// case), so existing callers that only know about Data keep working;
+	// with any other Payload, Data is left unset.
 	Data []byte
+
+	// Payload, if set, is encoded instead of Data, and is what Decode
+	// populates via DecodeConfig's DecoderConfig. Most callers can
+	// ignore it and use Data directly; it exists so a DecoderConfig can
+	// hand back a streaming Payload instead of a buffered []byte.
+	Payload Payload
+
+	// Properties is only encoded/decoded for hdr.Version >= 5.
+	Properties *Properties
 }
 
 func (msg *Publish) Encode(w io.Writer) (err error) {
@@ -223,12 +315,30 @@ func (msg *Publish) Encode(w io.Writer) (err error) {
 	if msg.Header.QosLevel.HasId() {
 		setUint16(msg.MessageId, buf)
 	}
-	buf.Write(msg.Data)
+	if msg.Header.Version >= Version5 {
+		msg.Properties.Encode(buf)
+	}
+
+	payload := msg.Payload
+	if payload == nil {
+		data := BytesPayload(msg.Data)
+		payload = &data
+	}
+
+	return writeMessageWithPayload(w, &msg.Header, MsgPublish, buf, payload)
+}
 
-	return writeMessage(w, &msg.Header, buf)
+// Decode is DecodeConfig using DefaultDecoderConfig, preserving the
+// historical behavior of buffering the whole payload into Data.
+func (msg *Publish) Decode(r io.Reader, hdr Header, packetRemaining int32) error {
+	return msg.DecodeConfig(r, hdr, packetRemaining, DefaultDecoderConfig)
 }
 
-func (msg *Publish) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
+// DecodeConfig is like Decode but builds the payload with config instead
+// of always buffering it into Data, letting a caller stream a large
+// Publish (e.g. a retained blob or firmware image) straight to its final
+// destination without holding it in memory.
+func (msg *Publish) DecodeConfig(r io.Reader, hdr Header, packetRemaining int32, config DecoderConfig) (err error) {
 	defer func() {
 		err = recoverError(err)
 	}()
@@ -237,10 +347,24 @@ func (msg *Publish) Decode(r io.Reader, hdr Header, packetRemaining int32) (err
 	if msg.Header.QosLevel.HasId() {
 		msg.MessageId = getUint16(r, &packetRemaining)
 	}
-	msg.Data = make([]byte, packetRemaining)
-	if _, err = io.ReadFull(r, msg.Data); err != nil {
+	if hdr.Version >= Version5 {
+		if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+			return err
+		}
+	}
+
+	if config == nil {
+		config = DefaultDecoderConfig
+	}
+	payload, err := config.MakePayload(msg, r, int(packetRemaining))
+	if err != nil {
 		return err
 	}
+	msg.Payload = payload
+	if bp, ok := payload.(*BytesPayload); ok {
+		msg.Data = []byte(*bp)
+	}
+
 	return nil
 }
 
@@ -248,36 +372,102 @@ type PubAck struct {
 	AckCommon
 }
 
+func (msg *PubAck) Encode(w io.Writer) error {
+	return msg.AckCommon.encode(w, MsgPubAck)
+}
+
 type PubRec struct {
 	AckCommon
 }
 
+func (msg *PubRec) Encode(w io.Writer) error {
+	return msg.AckCommon.encode(w, MsgPubRec)
+}
+
 type PubRel struct {
 	AckCommon
 }
 
+func (msg *PubRel) Encode(w io.Writer) error {
+	return msg.AckCommon.encode(w, MsgPubRel)
+}
+
 type PubComp struct {
 	AckCommon
 }
 
+func (msg *PubComp) Encode(w io.Writer) error {
+	return msg.AckCommon.encode(w, MsgPubComp)
+}
+
+// SubOptions carries the per-topic subscription options byte introduced in
+// MQTT 5: the granted/requested QoS plus the No Local, Retain As Published
+// and Retain Handling bits. For hdr.Version < 5, only Qos is meaningful.
+type SubOptions struct {
+	Qos               QosLevel
+	NoLocal           bool
+	RetainAsPublished bool
+	// RetainHandling is 0 (send retained messages at subscribe time),
+	// 1 (send only for a new subscription) or 2 (never send).
+	RetainHandling uint8
+}
+
+func (o SubOptions) encode() byte {
+	b := byte(o.Qos)
+	b |= boolToByte(o.NoLocal) << 2
+	b |= boolToByte(o.RetainAsPublished) << 3
+	b |= (o.RetainHandling & 0x03) << 4
+	return b
+}
+
+func decodeSubOptions(b byte) SubOptions {
+	return SubOptions{
+		Qos:               QosLevel(b & 0x03),
+		NoLocal:           b&0x04 > 0,
+		RetainAsPublished: b&0x08 > 0,
+		RetainHandling:    (b & 0x30) >> 4,
+	}
+}
+
 type Subscribe struct {
 	Header
 	MessageId uint16
-	Topics []string
+	Topics    []string
 	TopicsQos []QosLevel
+
+	// TopicsOptions and Properties are only encoded/decoded for
+	// hdr.Version >= 5, in which case they replace TopicsQos.
+	TopicsOptions []SubOptions
+	Properties    *Properties
 }
 
 func (msg *Subscribe) Encode(w io.Writer) (err error) {
+	if StrictTopicValidation {
+		for _, t := range msg.Topics {
+			if !topic.Filter(t).Valid() {
+				return badTopicFilterError
+			}
+		}
+	}
+
 	buf := new(bytes.Buffer)
 	if msg.Header.QosLevel.HasId() {
 		setUint16(msg.MessageId, buf)
 	}
-	for i := 0; i < len(msg.Topics); i += 1 {
-		setString(msg.Topics[i], buf)
-		setUint8(uint8(msg.TopicsQos[i]), buf)
+	if msg.Header.Version >= Version5 {
+		msg.Properties.Encode(buf)
+		for i := 0; i < len(msg.Topics); i += 1 {
+			setString(msg.Topics[i], buf)
+			buf.WriteByte(msg.TopicsOptions[i].encode())
+		}
+	} else {
+		for i := 0; i < len(msg.Topics); i += 1 {
+			setString(msg.Topics[i], buf)
+			setUint8(uint8(msg.TopicsQos[i]), buf)
+		}
 	}
 
-	return writeMessage(w, &msg.Header, buf)
+	return writeMessage(w, &msg.Header, MsgSubscribe, buf)
 }
 
 func (msg *Subscribe) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
@@ -288,14 +478,35 @@ func (msg *Subscribe) Decode(r io.Reader, hdr Header, packetRemaining int32) (er
 	if msg.Header.QosLevel.HasId() {
 		msg.MessageId = getUint16(r, &packetRemaining)
 	}
+	if hdr.Version >= Version5 {
+		if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+			return err
+		}
+	}
 	topics := make([]string, 0)
 	topicsQos := make([]QosLevel, 0)
+	topicsOptions := make([]SubOptions, 0)
 	for packetRemaining > 0 {
 		topics = append(topics, getString(r, &packetRemaining))
-		topicsQos = append(topicsQos, QosLevel(getUint8(r, &packetRemaining)))
+		if hdr.Version >= Version5 {
+			opts := decodeSubOptions(getUint8(r, &packetRemaining))
+			topicsOptions = append(topicsOptions, opts)
+			topicsQos = append(topicsQos, opts.Qos)
+		} else {
+			topicsQos = append(topicsQos, QosLevel(getUint8(r, &packetRemaining)))
+		}
 	}
+	if StrictTopicValidation {
+		for _, t := range topics {
+			if !topic.Filter(t).Valid() {
+				return badTopicFilterError
+			}
+		}
+	}
+
 	msg.Topics = topics
 	msg.TopicsQos = topicsQos
+	msg.TopicsOptions = topicsOptions
 
 	return nil
 }
@@ -304,16 +515,26 @@ type SubAck struct {
 	Header
 	MessageId uint16
 	TopicsQos []QosLevel
+
+	// Properties is only encoded/decoded for hdr.Version >= 5. In that
+	// case each entry of TopicsQos may instead hold a failure
+	// ReasonCode (cast to QosLevel's underlying type); callers that
+	// care about the distinction should check against the ReasonCode
+	// constants (>= 0x80 is always a failure).
+	Properties *Properties
 }
 
 func (msg *SubAck) Encode(w io.Writer) (err error) {
 	buf := new(bytes.Buffer)
 	setUint16(msg.MessageId, buf)
+	if msg.Header.Version >= Version5 {
+		msg.Properties.Encode(buf)
+	}
 	for i := 0; i < len(msg.TopicsQos); i += 1 {
 		setUint8(uint8(msg.TopicsQos[i]), buf)
 	}
 
-	return writeMessage(w, &msg.Header, buf)
+	return writeMessage(w, &msg.Header, MsgSubAck, buf)
 }
 
 func (msg *SubAck) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
@@ -322,10 +543,18 @@ func (msg *SubAck) Decode(r io.Reader, hdr Header, packetRemaining int32) (err e
 	}()
 
 	msg.MessageId = getUint16(r, &packetRemaining)
+	if hdr.Version >= Version5 {
+		if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+			return err
+		}
+	}
 	topicsQos := make([]QosLevel, 0)
 	for packetRemaining > 0 {
-		grantedQos := QosLevel(getUint8(r, &packetRemaining) & 0x03)
-		topicsQos = append(topicsQos, grantedQos)
+		code := getUint8(r, &packetRemaining)
+		if hdr.Version < Version5 {
+			code &= 0x03
+		}
+		topicsQos = append(topicsQos, QosLevel(code))
 	}
 	msg.TopicsQos = topicsQos
 
@@ -335,7 +564,10 @@ func (msg *SubAck) Decode(r io.Reader, hdr Header, packetRemaining int32) (err e
 type Unsubscribe struct {
 	Header
 	MessageId uint16
-	Topics []string
+	Topics    []string
+
+	// Properties is only encoded/decoded for hdr.Version >= 5.
+	Properties *Properties
 }
 
 func (msg *Unsubscribe) Encode(w io.Writer) (err error) {
@@ -343,11 +575,14 @@ func (msg *Unsubscribe) Encode(w io.Writer) (err error) {
 	if msg.Header.QosLevel.HasId() {
 		setUint16(msg.MessageId, buf)
 	}
+	if msg.Header.Version >= Version5 {
+		msg.Properties.Encode(buf)
+	}
 	for _, topic := range msg.Topics {
 		setString(topic, buf)
 	}
 
-	return writeMessage(w, &msg.Header, buf)
+	return writeMessage(w, &msg.Header, MsgUnsubscribe, buf)
 }
 
 func (msg *Unsubscribe) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
@@ -358,6 +593,11 @@ func (msg *Unsubscribe) Decode(r io.Reader, hdr Header, packetRemaining int32) (
 	if qos := msg.Header.QosLevel; qos == 1 || qos == 2 {
 		msg.MessageId = getUint16(r, &packetRemaining)
 	}
+	if hdr.Version >= Version5 {
+		if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+			return err
+		}
+	}
 	topics := make([]string, 0)
 	for packetRemaining > 0 {
 		topics = append(topics, getString(r, &packetRemaining))
@@ -371,16 +611,35 @@ type UnsubAck struct {
 	AckCommon
 }
 
+func (msg *UnsubAck) Encode(w io.Writer) error {
+	return msg.AckCommon.encode(w, MsgUnsubAck)
+}
+
 type AckCommon struct {
 	Header
 	MessageId uint16
+
+	// ReasonCode and Properties are only meaningful for hdr.Version >= 5.
+	// Per the MQTT 5 "success omit" rule, a v5 sender may elide both
+	// when the reason code is Success/0x00 and there are no properties;
+	// Decode leaves ReasonCode as its zero value (Success) and
+	// Properties nil in that case.
+	ReasonCode ReasonCode
+	Properties *Properties
 }
 
-func (msg *AckCommon) Encode(w io.Writer) (err error) {
+// encode is shared by PubAck/PubRec/PubRel/PubComp/UnsubAck's Encode
+// methods, which each supply their own MessageType since AckCommon's
+// embedders are otherwise indistinguishable on the wire.
+func (msg *AckCommon) encode(w io.Writer, msgType MessageType) (err error) {
 	buf := new(bytes.Buffer)
 	setUint16(msg.MessageId, buf)
+	if msg.Header.Version >= Version5 && (msg.ReasonCode != Success || msg.Properties != nil) {
+		setUint8(uint8(msg.ReasonCode), buf)
+		msg.Properties.Encode(buf)
+	}
 
-	return writeMessage(w, &msg.Header, buf)
+	return writeMessage(w, &msg.Header, msgType, buf)
 }
 
 func (msg *AckCommon) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
@@ -390,5 +649,111 @@ func (msg *AckCommon) Decode(r io.Reader, hdr Header, packetRemaining int32) (er
 
 	msg.MessageId = getUint16(r, &packetRemaining)
 
+	if hdr.Version >= Version5 && packetRemaining > 0 {
+		msg.ReasonCode = ReasonCode(getUint8(r, &packetRemaining))
+		if packetRemaining > 0 {
+			if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Disconnect is the MQTT 5 DISCONNECT packet. In MQTT 3.1/3.1.1 DISCONNECT
+// carries no variable header or payload at all; for hdr.Version < 5,
+// Encode writes none and Decode leaves ReasonCode/Properties unset.
+type Disconnect struct {
+	Header
+	ReasonCode ReasonCode
+	Properties *Properties
+}
+
+func (msg *Disconnect) Encode(w io.Writer) (err error) {
+	buf := new(bytes.Buffer)
+	if msg.Header.Version >= Version5 && (msg.ReasonCode != NormalDisconnection || msg.Properties != nil) {
+		setUint8(uint8(msg.ReasonCode), buf)
+		msg.Properties.Encode(buf)
+	}
+
+	return writeMessage(w, &msg.Header, MsgDisconnect, buf)
+}
+
+func (msg *Disconnect) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
+	defer func() {
+		err = recoverError(err)
+	}()
+
+	if hdr.Version >= Version5 && packetRemaining > 0 {
+		msg.ReasonCode = ReasonCode(getUint8(r, &packetRemaining))
+		if packetRemaining > 0 {
+			if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Auth is the MQTT 5 AUTH packet used for extended (e.g. challenge/
+// response) authentication exchanges. It did not exist before MQTT 5.
+type Auth struct {
+	Header
+	ReasonCode ReasonCode
+	Properties *Properties
+}
+
+func (msg *Auth) Encode(w io.Writer) (err error) {
+	buf := new(bytes.Buffer)
+	if msg.ReasonCode != Success || msg.Properties != nil {
+		setUint8(uint8(msg.ReasonCode), buf)
+		msg.Properties.Encode(buf)
+	}
+
+	return writeMessage(w, &msg.Header, MsgAuth, buf)
+}
+
+func (msg *Auth) Decode(r io.Reader, hdr Header, packetRemaining int32) (err error) {
+	defer func() {
+		err = recoverError(err)
+	}()
+
+	if packetRemaining > 0 {
+		msg.ReasonCode = ReasonCode(getUint8(r, &packetRemaining))
+		if packetRemaining > 0 {
+			if msg.Properties, err = DecodeProperties(r, &packetRemaining); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// PingReq and PingResp carry no variable header or payload in any
+// protocol version.
+type PingReq struct {
+	Header
+}
+
+func (msg *PingReq) Encode(w io.Writer) error {
+	return writeMessage(w, &msg.Header, MsgPingReq, new(bytes.Buffer))
+}
+
+func (msg *PingReq) Decode(r io.Reader, hdr Header, packetRemaining int32) error {
+	return nil
+}
+
+type PingResp struct {
+	Header
+}
+
+func (msg *PingResp) Encode(w io.Writer) error {
+	return writeMessage(w, &msg.Header, MsgPingResp, new(bytes.Buffer))
+}
+
+func (msg *PingResp) Decode(r io.Reader, hdr Header, packetRemaining int32) error {
 	return nil
 }
@@ -0,0 +1,146 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// QosLevel is the MQTT Quality of Service level: 0 (at most once), 1 (at
+// least once) or 2 (exactly once). The wire representation is always two
+// bits; 3 is reserved and never valid.
+type QosLevel uint8
+
+// IsValid reports whether q is one of the three defined QoS levels.
+func (q QosLevel) IsValid() bool {
+	return q <= 2
+}
+
+// HasId reports whether a Publish/Subscribe/Unsubscribe at this QoS
+// carries a MessageId: true for QoS 1 and 2, false for QoS 0.
+func (q QosLevel) HasId() bool {
+	return q == 1 || q == 2
+}
+
+// ReturnCode is the CONNACK return code defined by MQTT 3.1/3.1.1. MQTT 5
+// replaces it with the richer ReasonCode; see ConnAck.
+type ReturnCode uint8
+
+const (
+	RetCodeAccepted              = ReturnCode(0)
+	RetCodeUnacceptableProtocol  = ReturnCode(1)
+	RetCodeIdentifierRejected    = ReturnCode(2)
+	RetCodeServerUnavailable     = ReturnCode(3)
+	RetCodeBadUsernameOrPassword = ReturnCode(4)
+	RetCodeNotAuthorized         = ReturnCode(5)
+
+	retCodeFirstInvalid = ReturnCode(6)
+)
+
+// IsValid reports whether rc is one of the return codes defined by MQTT
+// 3.1/3.1.1.
+func (rc ReturnCode) IsValid() bool {
+	return rc < retCodeFirstInvalid
+}
+
+var (
+	badQosError        = errors.New("mqtt: invalid QoS level")
+	badMsgTypeError    = errors.New("mqtt: invalid message type")
+	badWillQosError    = errors.New("mqtt: invalid will QoS level")
+	badReturnCodeError = errors.New("mqtt: invalid CONNACK return code")
+)
+
+// recoverError lets a Decode method use a single deferred call to turn a
+// panic raised by the getXxx helpers (on a short read or similar) into
+// a returned error, instead of every call site checking an error after
+// every field it reads.
+func recoverError(err error) error {
+	if r := recover(); r != nil {
+		if e, ok := r.(error); ok {
+			return e
+		}
+		panic(r)
+	}
+	return err
+}
+
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// encodeLength writes length using the variable-byte-integer scheme MQTT
+// uses for the fixed header's Remaining Length (and, in MQTT 5, for the
+// Property Length and Subscription Identifier).
+func encodeLength(length int32, buf *bytes.Buffer) {
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		buf.WriteByte(digit)
+		if length == 0 {
+			break
+		}
+	}
+}
+
+// decodeLength reads a variable-byte-integer. It panics (to be caught by
+// recoverError) on a read error or a malformed (too long) encoding.
+func decodeLength(r io.Reader) int32 {
+	var value uint32
+	var multiplier uint32 = 1
+	var buf [1]byte
+
+	for i := 0; ; i++ {
+		if i == 4 {
+			panic(errors.New("mqtt: malformed variable byte integer"))
+		}
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			panic(err)
+		}
+		value += uint32(buf[0]&0x7F) * multiplier
+		if buf[0]&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+
+	return int32(value)
+}
+
+func setUint8(val uint8, buf *bytes.Buffer) {
+	buf.WriteByte(val)
+}
+
+func getUint8(r io.Reader, remaining *int32) uint8 {
+	var buf [1]byte
+	readPacket(r, buf[:], remaining)
+	return buf[0]
+}
+
+func setUint16(val uint16, buf *bytes.Buffer) {
+	buf.WriteByte(byte(val >> 8))
+	buf.WriteByte(byte(val))
+}
+
+func getUint16(r io.Reader, remaining *int32) uint16 {
+	var buf [2]byte
+	readPacket(r, buf[:], remaining)
+	return uint16(buf[0])<<8 | uint16(buf[1])
+}
+
+func setString(s string, buf *bytes.Buffer) {
+	setUint16(uint16(len(s)), buf)
+	buf.WriteString(s)
+}
+
+func getString(r io.Reader, remaining *int32) string {
+	n := getUint16(r, remaining)
+	buf := make([]byte, n)
+	readPacket(r, buf, remaining)
+	return string(buf)
+}
@@ -68,6 +68,72 @@ func Test(t *testing.T) {
 	}
 }
 
+func TestPublishV5RoundTrip(t *testing.T) {
+	expiry := uint32(60)
+	msg := Publish{
+		Header:    Header{QosLevel: 1, Version: Version5},
+		TopicName: "sensors/temp",
+		MessageId: 42,
+		Data:      []byte("21.5"),
+		Properties: &Properties{
+			MessageExpiryInterval: &expiry,
+			ContentType:           "text/plain",
+			UserProperties:        []UserProperty{{"unit", "celsius"}},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := msg.Encode(buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if got := MessageType(buf.Bytes()[0] & 0xF0 >> 4); got != MsgPublish {
+		t.Fatalf("encoded message type = %v, want MsgPublish", got)
+	}
+
+	decoded, err := DecodeReadVersion(buf, Version5)
+	if err != nil {
+		t.Fatalf("DecodeReadVersion: %v", err)
+	}
+	got, ok := decoded.(*Publish)
+	if !ok {
+		t.Fatalf("DecodeReadVersion returned %T, want *Publish", decoded)
+	}
+	got.Payload = nil // Decode always fills Payload; Data is what callers compare.
+
+	if !reflect.DeepEqual(&msg, got) {
+		t.Errorf("round trip mismatch\n     got = %#v\nexpected = %#v", got, &msg)
+	}
+}
+
+func TestPubAckReasonCodeRoundTrip(t *testing.T) {
+	msg := PubAck{AckCommon: AckCommon{
+		Header:     Header{Version: Version5},
+		MessageId:  7,
+		ReasonCode: NotAuthorized,
+	}}
+
+	buf := new(bytes.Buffer)
+	if err := msg.Encode(buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if got := MessageType(buf.Bytes()[0] & 0xF0 >> 4); got != MsgPubAck {
+		t.Fatalf("encoded message type = %v, want MsgPubAck", got)
+	}
+
+	decoded, err := DecodeReadVersion(buf, Version5)
+	if err != nil {
+		t.Fatalf("DecodeReadVersion: %v", err)
+	}
+	got, ok := decoded.(*PubAck)
+	if !ok {
+		t.Fatalf("DecodeReadVersion returned %T, want *PubAck", decoded)
+	}
+
+	if got.ReasonCode != NotAuthorized {
+		t.Errorf("ReasonCode = %v, want NotAuthorized", got.ReasonCode)
+	}
+}
+
 func TestDecodeLength(t *testing.T) {
 	tests := []struct {
 		Expected int32
@@ -0,0 +1,81 @@
+package mqtt
+
+import (
+	"bytes"
+	"io"
+)
+
+// Payload is the application data carried by a Publish. The built-in
+// BytesPayload buffers it in memory like Publish.Data always has; a
+// caller that needs to avoid buffering a large retained blob or firmware
+// image can implement Payload itself (for example, writing straight to
+// disk from ReadPayload) and hand it to a DecoderConfig.
+type Payload interface {
+	// Size returns the number of bytes WritePayload will write. It is
+	// used to compute the Publish's remaining length.
+	Size() int
+	WritePayload(w io.Writer) error
+	// ReadPayload reads from r until EOF. The caller (normally a
+	// DecoderConfig) is responsible for limiting r to the payload's
+	// length, e.g. with io.LimitReader.
+	ReadPayload(r io.Reader) error
+}
+
+// BytesPayload is the default, buffering Payload implementation: the same
+// behavior Publish.Data has always had.
+type BytesPayload []byte
+
+func (p BytesPayload) Size() int { return len(p) }
+
+func (p BytesPayload) WritePayload(w io.Writer) error {
+	_, err := w.Write(p)
+	return err
+}
+
+func (p *BytesPayload) ReadPayload(r io.Reader) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	*p = buf
+	return nil
+}
+
+// DecoderConfig constructs the Payload a Publish's Decode should populate
+// with the n bytes of message data remaining in r. Implementations that
+// want to stream rather than buffer should read from r themselves (e.g.
+// via io.Copy to a file) inside MakePayload, then return a Payload whose
+// WritePayload can reproduce it if the message is re-encoded.
+type DecoderConfig interface {
+	MakePayload(msg *Publish, r io.Reader, n int) (Payload, error)
+}
+
+// DefaultDecoderConfig reproduces Publish's historical behavior: the
+// payload is read fully into memory as a BytesPayload.
+var DefaultDecoderConfig DecoderConfig = defaultDecoderConfig{}
+
+type defaultDecoderConfig struct{}
+
+func (defaultDecoderConfig) MakePayload(msg *Publish, r io.Reader, n int) (Payload, error) {
+	p := make(BytesPayload, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// writeMessageWithPayload is writeMessage's counterpart for a Publish
+// whose payload may be large: headerBuf holds everything but the
+// payload, and payload is streamed to w directly rather than appended to
+// an in-memory buffer, so Encode never has to hold the whole message at
+// once.
+func writeMessageWithPayload(w io.Writer, hdr *Header, msgType MessageType, headerBuf *bytes.Buffer, payload Payload) error {
+	remainingLength := int32(headerBuf.Len()) + int32(payload.Size())
+	if err := hdr.Encode(w, msgType, remainingLength); err != nil {
+		return err
+	}
+	if _, err := w.Write(headerBuf.Bytes()); err != nil {
+		return err
+	}
+	return payload.WritePayload(w)
+}
@@ -0,0 +1,71 @@
+package mqtt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// countingPayload is a Payload that only tracks how many bytes it was
+// asked to write/read, to verify a custom DecoderConfig is consulted
+// instead of always buffering into Publish.Data.
+type countingPayload struct {
+	n int
+}
+
+func (p *countingPayload) Size() int { return p.n }
+
+func (p *countingPayload) WritePayload(w io.Writer) error {
+	_, err := w.Write(bytes.Repeat([]byte{'x'}, p.n))
+	return err
+}
+
+func (p *countingPayload) ReadPayload(r io.Reader) error {
+	n, err := io.Copy(io.Discard, r)
+	p.n = int(n)
+	return err
+}
+
+type countingDecoderConfig struct {
+	made *countingPayload
+}
+
+func (c *countingDecoderConfig) MakePayload(msg *Publish, r io.Reader, n int) (Payload, error) {
+	c.made = &countingPayload{}
+	if err := c.made.ReadPayload(io.LimitReader(r, int64(n))); err != nil {
+		return nil, err
+	}
+	return c.made, nil
+}
+
+func TestPublishDecodeConfig(t *testing.T) {
+	msg := Publish{
+		Header:    Header{QosLevel: 0},
+		TopicName: "a/b",
+		Data:      bytes.Repeat([]byte{'x'}, 10),
+	}
+
+	buf := new(bytes.Buffer)
+	if err := msg.Encode(buf); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var hdr Header
+	_, remaining, err := hdr.Decode(buf, Version4)
+	if err != nil {
+		t.Fatalf("Header.Decode: %v", err)
+	}
+
+	config := &countingDecoderConfig{}
+	var decoded Publish
+	if err := decoded.DecodeConfig(buf, hdr, remaining, config); err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+
+	if config.made == nil || config.made.n != 10 {
+		t.Errorf("custom DecoderConfig.MakePayload was not used to decode the payload")
+	}
+	if decoded.Payload != config.made {
+		t.Errorf("decoded.Payload = %#v, want the Payload returned by MakePayload", decoded.Payload)
+	}
+}
@@ -0,0 +1,357 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+var badPropertyIdError = errors.New("mqtt: unknown property identifier")
+
+// Property identifiers, as assigned by the MQTT 5 specification section 2.2.2.2.
+const (
+	propPayloadFormatIndicator          = 0x01
+	propMessageExpiryInterval           = 0x02
+	propContentType                     = 0x03
+	propResponseTopic                   = 0x08
+	propCorrelationData                 = 0x09
+	propSubscriptionIdentifier          = 0x0B
+	propSessionExpiryInterval           = 0x11
+	propAssignedClientIdentifier        = 0x12
+	propServerKeepAlive                 = 0x13
+	propAuthMethod                      = 0x15
+	propAuthData                        = 0x16
+	propRequestProblemInformation       = 0x17
+	propWillDelayInterval               = 0x18
+	propRequestResponseInformation      = 0x19
+	propResponseInformation             = 0x1A
+	propServerReference                 = 0x1C
+	propReasonString                    = 0x1F
+	propReceiveMaximum                  = 0x21
+	propTopicAliasMaximum               = 0x22
+	propTopicAlias                      = 0x23
+	propMaximumQos                      = 0x24
+	propRetainAvailable                 = 0x25
+	propUserProperty                    = 0x26
+	propMaximumPacketSize               = 0x27
+	propWildcardSubscriptionAvailable   = 0x28
+	propSubscriptionIdentifierAvailable = 0x29
+	propSharedSubscriptionAvailable     = 0x2A
+)
+
+// UserProperty is a single free-form name/value pair, as used by the MQTT 5
+// User Property. Unlike the other properties it may appear more than once
+// in the same property block.
+type UserProperty struct {
+	Key, Value string
+}
+
+// Properties carries the MQTT 5 identifier-prefixed variable-header and
+// payload properties. Every field is optional; a zero value means the
+// property was absent on the wire. Presence of repeatable properties is
+// indicated by a non-nil slice.
+//
+// Encode/Decode read and write the property block in the form the spec
+// calls "Properties": a Variable Byte Integer length (via encodeLength/
+// decodeLength) followed by that many bytes of identifier-prefixed
+// property values.
+type Properties struct {
+	PayloadFormatIndicator          *uint8
+	MessageExpiryInterval           *uint32
+	ContentType                     string
+	ResponseTopic                   string
+	CorrelationData                 []byte
+	SubscriptionIdentifiers         []uint32
+	SessionExpiryInterval           *uint32
+	AssignedClientIdentifier        string
+	ServerKeepAlive                 *uint16
+	AuthMethod                      string
+	AuthData                        []byte
+	RequestProblemInformation       *uint8
+	WillDelayInterval               *uint32
+	RequestResponseInformation      *uint8
+	ResponseInformation             string
+	ServerReference                 string
+	ReasonString                    string
+	ReceiveMaximum                  *uint16
+	TopicAliasMaximum               *uint16
+	TopicAlias                      *uint16
+	MaximumQos                      *uint8
+	RetainAvailable                 *uint8
+	UserProperties                  []UserProperty
+	MaximumPacketSize               *uint32
+	WildcardSubscriptionAvailable   *uint8
+	SubscriptionIdentifierAvailable *uint8
+	SharedSubscriptionAvailable     *uint8
+}
+
+func setUint32(val uint32, buf *bytes.Buffer) {
+	buf.WriteByte(byte(val >> 24))
+	buf.WriteByte(byte(val >> 16))
+	buf.WriteByte(byte(val >> 8))
+	buf.WriteByte(byte(val))
+}
+
+func getUint32(r io.Reader, remaining *int32) uint32 {
+	var b [4]byte
+	readPacket(r, b[:], remaining)
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func setBinary(data []byte, buf *bytes.Buffer) {
+	setUint16(uint16(len(data)), buf)
+	buf.Write(data)
+}
+
+func getBinary(r io.Reader, remaining *int32) []byte {
+	n := getUint16(r, remaining)
+	data := make([]byte, n)
+	readPacket(r, data, remaining)
+	return data
+}
+
+// readPacket reads exactly len(buf) bytes, decrementing *remaining, and
+// panics (to be caught by recoverError) on any error. It mirrors the
+// behaviour of the unexported getString/getUint8/getUint16 helpers.
+func readPacket(r io.Reader, buf []byte, remaining *int32) {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		panic(err)
+	}
+	*remaining -= int32(len(buf))
+}
+
+// Encode writes the property block, including its leading length prefix,
+// to buf.
+func (p *Properties) Encode(buf *bytes.Buffer) {
+	if p == nil {
+		encodeLength(0, buf)
+		return
+	}
+
+	props := new(bytes.Buffer)
+
+	if p.PayloadFormatIndicator != nil {
+		props.WriteByte(propPayloadFormatIndicator)
+		setUint8(*p.PayloadFormatIndicator, props)
+	}
+	if p.MessageExpiryInterval != nil {
+		props.WriteByte(propMessageExpiryInterval)
+		setUint32(*p.MessageExpiryInterval, props)
+	}
+	if p.ContentType != "" {
+		props.WriteByte(propContentType)
+		setString(p.ContentType, props)
+	}
+	if p.ResponseTopic != "" {
+		props.WriteByte(propResponseTopic)
+		setString(p.ResponseTopic, props)
+	}
+	if p.CorrelationData != nil {
+		props.WriteByte(propCorrelationData)
+		setBinary(p.CorrelationData, props)
+	}
+	for _, id := range p.SubscriptionIdentifiers {
+		props.WriteByte(propSubscriptionIdentifier)
+		encodeLength(int32(id), props)
+	}
+	if p.SessionExpiryInterval != nil {
+		props.WriteByte(propSessionExpiryInterval)
+		setUint32(*p.SessionExpiryInterval, props)
+	}
+	if p.AssignedClientIdentifier != "" {
+		props.WriteByte(propAssignedClientIdentifier)
+		setString(p.AssignedClientIdentifier, props)
+	}
+	if p.ServerKeepAlive != nil {
+		props.WriteByte(propServerKeepAlive)
+		setUint16(*p.ServerKeepAlive, props)
+	}
+	if p.AuthMethod != "" {
+		props.WriteByte(propAuthMethod)
+		setString(p.AuthMethod, props)
+	}
+	if p.AuthData != nil {
+		props.WriteByte(propAuthData)
+		setBinary(p.AuthData, props)
+	}
+	if p.RequestProblemInformation != nil {
+		props.WriteByte(propRequestProblemInformation)
+		setUint8(*p.RequestProblemInformation, props)
+	}
+	if p.WillDelayInterval != nil {
+		props.WriteByte(propWillDelayInterval)
+		setUint32(*p.WillDelayInterval, props)
+	}
+	if p.RequestResponseInformation != nil {
+		props.WriteByte(propRequestResponseInformation)
+		setUint8(*p.RequestResponseInformation, props)
+	}
+	if p.ResponseInformation != "" {
+		props.WriteByte(propResponseInformation)
+		setString(p.ResponseInformation, props)
+	}
+	if p.ServerReference != "" {
+		props.WriteByte(propServerReference)
+		setString(p.ServerReference, props)
+	}
+	if p.ReasonString != "" {
+		props.WriteByte(propReasonString)
+		setString(p.ReasonString, props)
+	}
+	if p.ReceiveMaximum != nil {
+		props.WriteByte(propReceiveMaximum)
+		setUint16(*p.ReceiveMaximum, props)
+	}
+	if p.TopicAliasMaximum != nil {
+		props.WriteByte(propTopicAliasMaximum)
+		setUint16(*p.TopicAliasMaximum, props)
+	}
+	if p.TopicAlias != nil {
+		props.WriteByte(propTopicAlias)
+		setUint16(*p.TopicAlias, props)
+	}
+	if p.MaximumQos != nil {
+		props.WriteByte(propMaximumQos)
+		setUint8(*p.MaximumQos, props)
+	}
+	if p.RetainAvailable != nil {
+		props.WriteByte(propRetainAvailable)
+		setUint8(*p.RetainAvailable, props)
+	}
+	for _, up := range p.UserProperties {
+		props.WriteByte(propUserProperty)
+		setString(up.Key, props)
+		setString(up.Value, props)
+	}
+	if p.MaximumPacketSize != nil {
+		props.WriteByte(propMaximumPacketSize)
+		setUint32(*p.MaximumPacketSize, props)
+	}
+	if p.WildcardSubscriptionAvailable != nil {
+		props.WriteByte(propWildcardSubscriptionAvailable)
+		setUint8(*p.WildcardSubscriptionAvailable, props)
+	}
+	if p.SubscriptionIdentifierAvailable != nil {
+		props.WriteByte(propSubscriptionIdentifierAvailable)
+		setUint8(*p.SubscriptionIdentifierAvailable, props)
+	}
+	if p.SharedSubscriptionAvailable != nil {
+		props.WriteByte(propSharedSubscriptionAvailable)
+		setUint8(*p.SharedSubscriptionAvailable, props)
+	}
+
+	encodeLength(int32(props.Len()), buf)
+	buf.Write(props.Bytes())
+}
+
+// DecodeProperties reads a property block (length prefix plus identifier-
+// prefixed properties) from r, consuming from *remaining as it goes.
+func DecodeProperties(r io.Reader, remaining *int32) (p *Properties, err error) {
+	defer func() {
+		err = recoverError(err)
+	}()
+
+	length := decodeLength(r)
+	*remaining -= varByteIntLen(length)
+	propsRemaining := length
+
+	p = &Properties{}
+	for propsRemaining > 0 {
+		id := getUint8(r, &propsRemaining)
+		switch id {
+		case propPayloadFormatIndicator:
+			v := getUint8(r, &propsRemaining)
+			p.PayloadFormatIndicator = &v
+		case propMessageExpiryInterval:
+			v := getUint32(r, &propsRemaining)
+			p.MessageExpiryInterval = &v
+		case propContentType:
+			p.ContentType = getString(r, &propsRemaining)
+		case propResponseTopic:
+			p.ResponseTopic = getString(r, &propsRemaining)
+		case propCorrelationData:
+			p.CorrelationData = getBinary(r, &propsRemaining)
+		case propSubscriptionIdentifier:
+			v := decodeLength(r)
+			propsRemaining -= varByteIntLen(v)
+			p.SubscriptionIdentifiers = append(p.SubscriptionIdentifiers, uint32(v))
+		case propSessionExpiryInterval:
+			v := getUint32(r, &propsRemaining)
+			p.SessionExpiryInterval = &v
+		case propAssignedClientIdentifier:
+			p.AssignedClientIdentifier = getString(r, &propsRemaining)
+		case propServerKeepAlive:
+			v := getUint16(r, &propsRemaining)
+			p.ServerKeepAlive = &v
+		case propAuthMethod:
+			p.AuthMethod = getString(r, &propsRemaining)
+		case propAuthData:
+			p.AuthData = getBinary(r, &propsRemaining)
+		case propRequestProblemInformation:
+			v := getUint8(r, &propsRemaining)
+			p.RequestProblemInformation = &v
+		case propWillDelayInterval:
+			v := getUint32(r, &propsRemaining)
+			p.WillDelayInterval = &v
+		case propRequestResponseInformation:
+			v := getUint8(r, &propsRemaining)
+			p.RequestResponseInformation = &v
+		case propResponseInformation:
+			p.ResponseInformation = getString(r, &propsRemaining)
+		case propServerReference:
+			p.ServerReference = getString(r, &propsRemaining)
+		case propReasonString:
+			p.ReasonString = getString(r, &propsRemaining)
+		case propReceiveMaximum:
+			v := getUint16(r, &propsRemaining)
+			p.ReceiveMaximum = &v
+		case propTopicAliasMaximum:
+			v := getUint16(r, &propsRemaining)
+			p.TopicAliasMaximum = &v
+		case propTopicAlias:
+			v := getUint16(r, &propsRemaining)
+			p.TopicAlias = &v
+		case propMaximumQos:
+			v := getUint8(r, &propsRemaining)
+			p.MaximumQos = &v
+		case propRetainAvailable:
+			v := getUint8(r, &propsRemaining)
+			p.RetainAvailable = &v
+		case propUserProperty:
+			key := getString(r, &propsRemaining)
+			value := getString(r, &propsRemaining)
+			p.UserProperties = append(p.UserProperties, UserProperty{key, value})
+		case propMaximumPacketSize:
+			v := getUint32(r, &propsRemaining)
+			p.MaximumPacketSize = &v
+		case propWildcardSubscriptionAvailable:
+			v := getUint8(r, &propsRemaining)
+			p.WildcardSubscriptionAvailable = &v
+		case propSubscriptionIdentifierAvailable:
+			v := getUint8(r, &propsRemaining)
+			p.SubscriptionIdentifierAvailable = &v
+		case propSharedSubscriptionAvailable:
+			v := getUint8(r, &propsRemaining)
+			p.SharedSubscriptionAvailable = &v
+		default:
+			return nil, badPropertyIdError
+		}
+	}
+	*remaining -= length
+
+	return p, nil
+}
+
+// varByteIntLen returns the number of bytes encodeLength would emit for v.
+func varByteIntLen(v int32) int32 {
+	switch {
+	case v < 0x80:
+		return 1
+	case v < 0x4000:
+		return 2
+	case v < 0x200000:
+		return 3
+	default:
+		return 4
+	}
+}
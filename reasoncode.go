@@ -0,0 +1,70 @@
+package mqtt
+
+// ReasonCode is the MQTT 5 single-byte (or omitted, in the "success" case)
+// outcome code carried by CONNACK, PUBACK, PUBREC, PUBREL, PUBCOMP,
+// SUBACK, UNSUBACK, DISCONNECT and AUTH packets. It has no equivalent in
+// MQTT 3.1/3.1.1, where ConnAck.ReturnCode is the closest analogue.
+type ReasonCode uint8
+
+const (
+	Success                             = ReasonCode(0x00)
+	NormalDisconnection                 = ReasonCode(0x00)
+	GrantedQos0                         = ReasonCode(0x00)
+	GrantedQos1                         = ReasonCode(0x01)
+	GrantedQos2                         = ReasonCode(0x02)
+	DisconnectWithWillMessage           = ReasonCode(0x04)
+	NoMatchingSubscribers               = ReasonCode(0x10)
+	NoSubscriptionExisted               = ReasonCode(0x11)
+	ContinueAuthentication              = ReasonCode(0x18)
+	ReAuthenticate                      = ReasonCode(0x19)
+	UnspecifiedError                    = ReasonCode(0x80)
+	MalformedPacket                     = ReasonCode(0x81)
+	ProtocolError                       = ReasonCode(0x82)
+	ImplementationSpecificError         = ReasonCode(0x83)
+	UnsupportedProtocolVersion          = ReasonCode(0x84)
+	ClientIdentifierNotValid            = ReasonCode(0x85)
+	BadUserNameOrPassword               = ReasonCode(0x86)
+	NotAuthorized                       = ReasonCode(0x87)
+	ServerUnavailable                   = ReasonCode(0x88)
+	ServerBusy                          = ReasonCode(0x89)
+	Banned                              = ReasonCode(0x8A)
+	ServerShuttingDown                  = ReasonCode(0x8B)
+	BadAuthenticationMethod             = ReasonCode(0x8C)
+	KeepAliveTimeout                    = ReasonCode(0x8D)
+	SessionTakenOver                    = ReasonCode(0x8E)
+	TopicFilterInvalid                  = ReasonCode(0x8F)
+	TopicNameInvalid                    = ReasonCode(0x90)
+	PacketIdentifierInUse               = ReasonCode(0x91)
+	PacketIdentifierNotFound            = ReasonCode(0x92)
+	ReceiveMaximumExceeded              = ReasonCode(0x93)
+	TopicAliasInvalid                   = ReasonCode(0x94)
+	PacketTooLarge                      = ReasonCode(0x95)
+	MessageRateTooHigh                  = ReasonCode(0x96)
+	QuotaExceeded                       = ReasonCode(0x97)
+	AdministrativeAction                = ReasonCode(0x98)
+	PayloadFormatInvalid                = ReasonCode(0x99)
+	RetainNotSupported                  = ReasonCode(0x9A)
+	QosNotSupported                     = ReasonCode(0x9B)
+	UseAnotherServer                    = ReasonCode(0x9C)
+	ServerMoved                         = ReasonCode(0x9D)
+	SharedSubscriptionsNotSupported     = ReasonCode(0x9E)
+	ConnectionRateExceeded              = ReasonCode(0x9F)
+	MaximumConnectTime                  = ReasonCode(0xA0)
+	SubscriptionIdentifiersNotSupported = ReasonCode(0xA1)
+	WildcardSubscriptionsNotSupported   = ReasonCode(0xA2)
+)
+
+// IsValid reports whether rc is one of the reason codes defined by the
+// MQTT 5 specification. It does not check that rc is legal for the
+// particular packet type it appears in.
+func (rc ReasonCode) IsValid() bool {
+	switch rc {
+	case 0x00, 0x01, 0x02, 0x04, 0x10, 0x11, 0x18, 0x19,
+		0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89, 0x8A,
+		0x8B, 0x8C, 0x8D, 0x8E, 0x8F, 0x90, 0x91, 0x92, 0x93, 0x94, 0x95,
+		0x96, 0x97, 0x98, 0x99, 0x9A, 0x9B, 0x9C, 0x9D, 0x9E, 0x9F, 0xA0,
+		0xA1, 0xA2:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,5 @@
+package server
+
+import "errors"
+
+var errNotConnect = errors.New("mqtt: server: first packet on a new connection was not CONNECT")
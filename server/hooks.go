@@ -0,0 +1,57 @@
+package server
+
+import "github.com/imsbhatnagar/mqtt"
+
+// Authenticator decides whether a CONNECT may proceed, based on the
+// username/password fields it carried (Connect.UsernameFlag/PasswordFlag
+// indicate whether they were actually sent).
+type Authenticator interface {
+	Authenticate(connect *mqtt.Connect) (ok bool, reason string)
+}
+
+// AuthenticatorFunc adapts a plain function to an Authenticator.
+type AuthenticatorFunc func(connect *mqtt.Connect) (bool, string)
+
+func (f AuthenticatorFunc) Authenticate(connect *mqtt.Connect) (bool, string) {
+	return f(connect)
+}
+
+// AllowAll is an Authenticator that accepts every CONNECT without
+// inspecting credentials. It is the Config default, matching the
+// behaviour of the bare codec before this package existed.
+var AllowAll Authenticator = AuthenticatorFunc(func(*mqtt.Connect) (bool, string) { return true, "" })
+
+// Authorizer decides whether an already-authenticated client may publish
+// or subscribe to a given topic/filter.
+type Authorizer interface {
+	CanPublish(clientId, topic string) bool
+	CanSubscribe(clientId, filter string) bool
+}
+
+// AllowAllAuthorizer is an Authorizer that permits every publish and
+// subscribe. It is the Config default.
+var AllowAllAuthorizer Authorizer = allowAllAuthorizer{}
+
+type allowAllAuthorizer struct{}
+
+func (allowAllAuthorizer) CanPublish(clientId, topic string) bool    { return true }
+func (allowAllAuthorizer) CanSubscribe(clientId, filter string) bool { return true }
+
+// Metrics receives counters from a running Server. Implementations must
+// be safe for concurrent use; a Config with no Metrics set discards them.
+type Metrics interface {
+	ConnectionOpened()
+	ConnectionClosed()
+	MessagePublished(qos QosLevel)
+	MessageDropped(reason string)
+}
+
+// NopMetrics discards every call. It is the Config default.
+var NopMetrics Metrics = nopMetrics{}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ConnectionOpened()            {}
+func (nopMetrics) ConnectionClosed()            {}
+func (nopMetrics) MessagePublished(QosLevel)    {}
+func (nopMetrics) MessageDropped(reason string) {}
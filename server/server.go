@@ -0,0 +1,149 @@
+// Package server implements a streaming MQTT broker on top of the mqtt
+// codec package: it accepts connections, decodes frames with
+// mqtt.DecodeRead, and dispatches them through the pluggable SessionStore,
+// RetainedStore and SubscriptionTrie in this package, plus the
+// Authenticator/Authorizer/Metrics hooks in hooks.go.
+package server
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/imsbhatnagar/mqtt"
+)
+
+// Config configures a Server. The zero Config is not usable; use
+// NewConfig to get one with the in-memory stores and permissive hooks
+// filled in, then override only what differs.
+type Config struct {
+	Sessions      SessionStore
+	Retained      RetainedStore
+	Subscriptions *SubscriptionTrie
+
+	Authenticator Authenticator
+	Authorizer    Authorizer
+	Metrics       Metrics
+
+	// Logger receives one line per session-level error (bad packet,
+	// keep-alive timeout, etc). A nil Logger discards them.
+	Logger *log.Logger
+}
+
+// NewConfig returns a Config using in-memory stores and permissive hooks,
+// suitable as a starting point for overriding individual fields.
+func NewConfig() *Config {
+	return &Config{
+		Sessions:      NewMemSessionStore(),
+		Retained:      NewMemRetainedStore(),
+		Subscriptions: NewSubscriptionTrie(),
+		Authenticator: AllowAll,
+		Authorizer:    AllowAllAuthorizer,
+		Metrics:       NopMetrics,
+	}
+}
+
+// Server accepts connections and runs one Session per connection.
+type Server struct {
+	config *Config
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// New returns a Server using config. Passing nil uses NewConfig().
+func New(config *Config) *Server {
+	if config == nil {
+		config = NewConfig()
+	}
+	if config.Metrics == nil {
+		config.Metrics = NopMetrics
+	}
+	return &Server{config: config, sessions: make(map[string]*Session)}
+}
+
+// ListenAndServe listens on addr and serves connections until it
+// encounters an error accepting (including the listener being closed).
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// ListenAndServeTLS is ListenAndServe over a TLS listener.
+func (s *Server) ListenAndServeTLS(addr string, tlsConfig *tls.Config) error {
+	ln, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections from ln until Accept returns an error, running
+// one Session per accepted connection in its own goroutine.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	sess := newSession(s, conn)
+	s.config.Metrics.ConnectionOpened()
+	defer s.config.Metrics.ConnectionClosed()
+
+	sess.run()
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.config.Logger != nil {
+		s.config.Logger.Printf(format, args...)
+	}
+}
+
+func (s *Server) addSession(sess *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.sessions[sess.clientId]; ok {
+		// MQTT requires that a new connection for the same ClientId
+		// take over from, and disconnect, any existing one.
+		old.takenOver()
+	}
+	s.sessions[sess.clientId] = sess
+}
+
+func (s *Server) removeSession(sess *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions[sess.clientId] == sess {
+		delete(s.sessions, sess.clientId)
+	}
+}
+
+// Publish routes msg to every matching subscriber and, if msg.Retain is
+// set, updates the retained store. It is exported so application code
+// (e.g. a bridge, or an admin API) can inject a Publish that did not come
+// from a client connection.
+func (s *Server) Publish(msg *mqtt.Publish) {
+	if msg.Header.Retain {
+		s.config.Retained.Set(msg)
+	}
+
+	for _, sub := range s.config.Subscriptions.Match(msg.TopicName) {
+		s.mu.Lock()
+		sess := s.sessions[sub.ClientId]
+		s.mu.Unlock()
+		if sess == nil {
+			continue
+		}
+		sess.deliver(msg, sub.Qos)
+	}
+	s.config.Metrics.MessagePublished(msg.Header.QosLevel)
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"net"
+	"time"
+
+	"github.com/imsbhatnagar/mqtt"
+)
+
+// keepAliveGrace is how much longer than the negotiated keep-alive
+// interval a Session waits before timing a client out, matching the
+// "one and a half times" grace the MQTT spec recommends.
+const keepAliveGrace = 150 // percent
+
+// Session owns one client connection for its lifetime: a goroutine reads
+// decoded packets off the wire into incoming, and run() drives the
+// protocol state machine off that channel plus outgoing (messages queued
+// for delivery to this client) and a keep-alive timer.
+type Session struct {
+	server *Server
+	conn   net.Conn
+
+	clientId     string
+	cleanSession bool
+	will         *mqtt.Publish
+
+	incoming chan mqtt.Message
+	readErrs chan error
+	outgoing chan outboundMsg
+	closed   chan struct{}
+
+	keepAlive time.Duration
+	// version is the MQTT protocol level negotiated by the CONNECT this
+	// session started with; every packet read after that on this
+	// connection is decoded as this version, since the version itself is
+	// not part of a packet's fixed header.
+	version uint8
+
+	nextMessageId uint16
+	state         *SessionState
+}
+
+type outboundMsg struct {
+	publish *mqtt.Publish
+	qos     QosLevel
+}
+
+func newSession(server *Server, conn net.Conn) *Session {
+	return &Session{
+		server:   server,
+		conn:     conn,
+		incoming: make(chan mqtt.Message),
+		readErrs: make(chan error, 1),
+		outgoing: make(chan outboundMsg, 32),
+		closed:   make(chan struct{}),
+	}
+}
+
+// deliver queues msg for asynchronous delivery to this session at the
+// lesser of msg's QoS and the subscription's granted QoS, as required by
+// the spec. It never blocks the caller on a slow client; a client whose
+// outgoing queue is full is disconnected, matching the "a slow subscriber
+// must not stall the broker" expectation of a production server.
+func (sess *Session) deliver(msg *mqtt.Publish, subQos QosLevel) {
+	qos := msg.Header.QosLevel
+	if subQos < qos {
+		qos = subQos
+	}
+	select {
+	case sess.outgoing <- outboundMsg{msg, qos}:
+	case <-sess.closed:
+	default:
+		sess.server.config.Metrics.MessageDropped("outgoing queue full")
+		sess.Close()
+	}
+}
+
+// takenOver closes a session that has just been superseded by a new
+// CONNECT for the same ClientId.
+func (sess *Session) takenOver() {
+	sess.Close()
+}
+
+// Close disconnects the session's underlying connection. It is safe to
+// call more than once and from any goroutine.
+func (sess *Session) Close() {
+	select {
+	case <-sess.closed:
+	default:
+		close(sess.closed)
+		sess.conn.Close()
+	}
+}
+
+// run reads the CONNECT, completes the handshake, then drives the
+// session until the connection closes or a protocol error occurs.
+func (sess *Session) run() {
+	defer sess.onDisconnect(true)
+
+	connect, err := sess.readConnect()
+	if err != nil {
+		sess.server.logf("mqtt: session %s: reading CONNECT: %v", sess.conn.RemoteAddr(), err)
+		return
+	}
+
+	if !sess.handleConnect(connect) {
+		return
+	}
+
+	go sess.readLoop()
+
+	var keepAliveTimer *time.Timer
+	var keepAliveC <-chan time.Time
+	if sess.keepAlive > 0 {
+		keepAliveTimer = time.NewTimer(sess.keepAlive * keepAliveGrace / 100)
+		keepAliveC = keepAliveTimer.C
+		defer keepAliveTimer.Stop()
+	}
+
+	for {
+		select {
+		case msg := <-sess.incoming:
+			if keepAliveTimer != nil {
+				if !keepAliveTimer.Stop() {
+					<-keepAliveTimer.C
+				}
+				keepAliveTimer.Reset(sess.keepAlive * keepAliveGrace / 100)
+			}
+			if !sess.handleMessage(msg) {
+				return
+			}
+
+		case err := <-sess.readErrs:
+			if err != nil {
+				sess.server.logf("mqtt: session %s: %v", sess.clientId, err)
+			}
+			return
+
+		case out := <-sess.outgoing:
+			if err := sess.sendPublish(out.publish, out.qos); err != nil {
+				return
+			}
+
+		case <-keepAliveC:
+			sess.server.logf("mqtt: session %s: keep-alive timeout", sess.clientId)
+			return
+
+		case <-sess.closed:
+			return
+		}
+	}
+}
+
+func (sess *Session) readConnect() (*mqtt.Connect, error) {
+	msg, err := mqtt.DecodeRead(sess.conn)
+	if err != nil {
+		return nil, err
+	}
+	connect, ok := msg.(*mqtt.Connect)
+	if !ok {
+		return nil, errNotConnect
+	}
+	return connect, nil
+}
+
+func (sess *Session) handleConnect(connect *mqtt.Connect) bool {
+	ok, _ := sess.server.config.Authenticator.Authenticate(connect)
+	if !ok {
+		sess.sendConnAck(mqtt.ReturnCode(5)) // Not authorized.
+		return false
+	}
+
+	sess.clientId = connect.ClientId
+	sess.cleanSession = connect.CleanSession
+	sess.keepAlive = time.Duration(connect.KeepAliveTimer) * time.Second
+	sess.version = connect.ProtocolVersion
+
+	if connect.WillFlag {
+		sess.will = &mqtt.Publish{
+			Header:    mqtt.Header{Retain: connect.WillRetain, QosLevel: connect.WillQos},
+			TopicName: connect.WillTopic,
+			Data:      []byte(connect.WillMessage),
+		}
+	}
+
+	sessionPresent := false
+	if connect.CleanSession {
+		sess.server.config.Sessions.Delete(sess.clientId)
+		sess.server.config.Subscriptions.UnsubscribeAll(sess.clientId)
+		sess.state = newSessionState(sess.clientId)
+	} else if state, ok := sess.server.config.Sessions.Get(sess.clientId); ok {
+		sess.state = state
+		sessionPresent = true
+	} else {
+		sess.state = newSessionState(sess.clientId)
+	}
+
+	sess.server.addSession(sess)
+
+	if err := sess.sendConnAckPresent(mqtt.ReturnCode(0), sessionPresent); err != nil {
+		return false
+	}
+
+	sess.replayInFlight()
+
+	return true
+}
+
+func (sess *Session) sendConnAck(rc mqtt.ReturnCode) error {
+	return sess.sendConnAckPresent(rc, false)
+}
+
+func (sess *Session) sendConnAckPresent(rc mqtt.ReturnCode, present bool) error {
+	ack := &mqtt.ConnAck{SessionPresent: present, ReturnCode: rc}
+	return ack.Encode(sess.conn)
+}
+
+// replayInFlight resends any outbound QoS 1/2 Publishes left over from a
+// prior connection under the same (non-clean) session, with the DUP flag
+// set, per the MQTT reconnect semantics.
+func (sess *Session) replayInFlight() {
+	for id, inflight := range sess.state.Outbound {
+		msg := *inflight.Publish
+		msg.MessageId = id
+		msg.Header.DupFlag = true
+		msg.Encode(sess.conn)
+	}
+}
+
+func (sess *Session) readLoop() {
+	for {
+		msg, err := mqtt.DecodeReadVersion(sess.conn, sess.version)
+		if err != nil {
+			sess.readErrs <- err
+			return
+		}
+		select {
+		case sess.incoming <- msg:
+		case <-sess.closed:
+			return
+		}
+	}
+}
+
+func (sess *Session) handleMessage(msg mqtt.Message) bool {
+	switch m := msg.(type) {
+	case *mqtt.Publish:
+		return sess.handlePublish(m)
+	case *mqtt.PubAck:
+		delete(sess.state.Outbound, m.MessageId)
+	case *mqtt.PubRec:
+		if inflight, ok := sess.state.Outbound[m.MessageId]; ok {
+			inflight.AwaitingPubRel = true
+			rel := &mqtt.PubRel{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+			rel.Header.QosLevel = 1
+			rel.Encode(sess.conn)
+		}
+	case *mqtt.PubRel:
+		if inflight, ok := sess.state.Inbound[m.MessageId]; ok {
+			delete(sess.state.Inbound, m.MessageId)
+			sess.server.Publish(inflight.Publish)
+		}
+		comp := &mqtt.PubComp{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+		comp.Encode(sess.conn)
+	case *mqtt.PubComp:
+		delete(sess.state.Outbound, m.MessageId)
+	case *mqtt.Subscribe:
+		return sess.handleSubscribe(m)
+	case *mqtt.Unsubscribe:
+		return sess.handleUnsubscribe(m)
+	case *mqtt.PingReq:
+		resp := &mqtt.PingResp{}
+		resp.Encode(sess.conn)
+	case *mqtt.Disconnect:
+		sess.will = nil // Graceful disconnect: do not publish the LWT.
+		return false
+	}
+	return true
+}
+
+func (sess *Session) handlePublish(m *mqtt.Publish) bool {
+	if !sess.server.config.Authorizer.CanPublish(sess.clientId, m.TopicName) {
+		return true
+	}
+
+	switch m.Header.QosLevel {
+	case 0:
+		sess.server.Publish(m)
+	case 1:
+		sess.server.Publish(m)
+		ack := &mqtt.PubAck{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+		ack.Encode(sess.conn)
+	case 2:
+		sess.state.Inbound[m.MessageId] = &InFlight{MessageId: m.MessageId, Publish: m}
+		rec := &mqtt.PubRec{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+		rec.Encode(sess.conn)
+		// The Publish is fanned out on the matching PubRel, per the
+		// exactly-once handshake, not here.
+	}
+	return true
+}
+
+func (sess *Session) handleSubscribe(m *mqtt.Subscribe) bool {
+	granted := make([]QosLevel, len(m.Topics))
+	for i, topic := range m.Topics {
+		qos := m.TopicsQos[i]
+		if !sess.server.config.Authorizer.CanSubscribe(sess.clientId, topic) {
+			granted[i] = 0x80 // Failure.
+			continue
+		}
+		sess.server.config.Subscriptions.Subscribe(Subscription{ClientId: sess.clientId, Filter: topic, Qos: qos})
+		sess.state.Subscriptions = append(sess.state.Subscriptions, Subscription{ClientId: sess.clientId, Filter: topic, Qos: qos})
+		granted[i] = qos
+
+		for _, retained := range sess.server.config.Retained.Match(topic) {
+			sess.deliver(retained, qos)
+		}
+	}
+
+	ack := &mqtt.SubAck{MessageId: m.MessageId, TopicsQos: granted}
+	ack.Encode(sess.conn)
+	return true
+}
+
+func (sess *Session) handleUnsubscribe(m *mqtt.Unsubscribe) bool {
+	for _, topic := range m.Topics {
+		sess.server.config.Subscriptions.Unsubscribe(sess.clientId, topic)
+	}
+	ack := &mqtt.UnsubAck{AckCommon: mqtt.AckCommon{MessageId: m.MessageId}}
+	ack.Encode(sess.conn)
+	return true
+}
+
+func (sess *Session) sendPublish(msg *mqtt.Publish, qos QosLevel) error {
+	out := *msg
+	out.Header.QosLevel = qos
+	if qos > 0 {
+		out.MessageId = sess.nextId()
+		sess.state.Outbound[out.MessageId] = &InFlight{MessageId: out.MessageId, Publish: &out}
+	}
+	return out.Encode(sess.conn)
+}
+
+// nextId assigns the next outbound message id, wrapping from 0xFFFF back
+// to 1 (0 is reserved) and skipping ids still outstanding.
+func (sess *Session) nextId() uint16 {
+	for {
+		sess.nextMessageId++
+		if sess.nextMessageId == 0 {
+			sess.nextMessageId = 1
+		}
+		if _, outstanding := sess.state.Outbound[sess.nextMessageId]; !outstanding {
+			return sess.nextMessageId
+		}
+	}
+}
+
+func (sess *Session) onDisconnect(ungraceful bool) {
+	sess.Close()
+	sess.server.removeSession(sess)
+
+	if ungraceful && sess.will != nil {
+		sess.server.Publish(sess.will)
+	}
+
+	if sess.cleanSession {
+		sess.server.config.Sessions.Delete(sess.clientId)
+		sess.server.config.Subscriptions.UnsubscribeAll(sess.clientId)
+	} else if sess.state != nil {
+		sess.server.config.Sessions.Put(sess.state)
+	}
+}
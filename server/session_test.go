@@ -0,0 +1,50 @@
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/imsbhatnagar/mqtt"
+)
+
+func TestSessionPubRelFansOutInboundPublish(t *testing.T) {
+	srv := New(nil)
+
+	subConn, _ := net.Pipe()
+	defer subConn.Close()
+	sub := newSession(srv, subConn)
+	sub.clientId = "sub"
+	sub.state = newSessionState(sub.clientId)
+	srv.addSession(sub)
+	srv.config.Subscriptions.Subscribe(Subscription{ClientId: sub.clientId, Filter: "a/b", Qos: 2})
+
+	pubPeer, pubConn := net.Pipe()
+	defer pubConn.Close()
+	go io.Copy(io.Discard, pubPeer)
+	sess := newSession(srv, pubConn)
+	sess.clientId = "pub"
+	sess.state = newSessionState(sess.clientId)
+	pub := &mqtt.Publish{
+		Header:    mqtt.Header{QosLevel: 2},
+		TopicName: "a/b",
+		MessageId: 1,
+		Data:      []byte("hi"),
+	}
+	sess.state.Inbound[1] = &InFlight{MessageId: 1, Publish: pub}
+
+	sess.handleMessage(&mqtt.PubRel{AckCommon: mqtt.AckCommon{MessageId: 1}})
+
+	if _, ok := sess.state.Inbound[1]; ok {
+		t.Errorf("Inbound[1] still present after PUBREL")
+	}
+
+	select {
+	case out := <-sub.outgoing:
+		if out.publish.TopicName != "a/b" {
+			t.Errorf("delivered topic = %q, want %q", out.publish.TopicName, "a/b")
+		}
+	default:
+		t.Error("PUBREL did not fan the Publish out to the subscriber")
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/imsbhatnagar/mqtt"
+)
+
+// QosLevel is an alias for mqtt.QosLevel so that callers of this package
+// do not need to import the codec package just to name a QoS level.
+type QosLevel = mqtt.QosLevel
+
+// InFlight is one outbound or inbound QoS 1/2 message a Session is still
+// waiting to complete the handshake for.
+type InFlight struct {
+	MessageId uint16
+	Publish   *mqtt.Publish
+	// AwaitingPubRel is set for an outbound QoS 2 Publish that has been
+	// PUBREC'd and answered with PUBREL, and is now waiting for the
+	// matching PUBCOMP.
+	AwaitingPubRel bool
+}
+
+// SessionState is everything about a client session that must survive a
+// disconnect when CleanSession is false: in-flight QoS 1/2 message state
+// and the client's subscriptions, so they can be restored and any queued
+// messages replayed on reconnect.
+type SessionState struct {
+	ClientId      string
+	Subscriptions []Subscription
+	Outbound      map[uint16]*InFlight
+	Inbound       map[uint16]*InFlight
+}
+
+func newSessionState(clientId string) *SessionState {
+	return &SessionState{
+		ClientId: clientId,
+		Outbound: make(map[uint16]*InFlight),
+		Inbound:  make(map[uint16]*InFlight),
+	}
+}
+
+// SessionStore holds SessionState across reconnects, keyed by ClientId.
+// Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Get returns the stored state for clientId, or ok == false if there
+	// is none (e.g. first connect, or a prior clean-session disconnect).
+	Get(clientId string) (state *SessionState, ok bool)
+	// Put saves state, replacing whatever was previously stored for
+	// state.ClientId.
+	Put(state *SessionState)
+	// Delete removes any stored state for clientId, used when a client
+	// connects with CleanSession set.
+	Delete(clientId string)
+}
+
+// MemSessionStore is an in-memory SessionStore. Sessions do not survive a
+// process restart.
+type MemSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*SessionState
+}
+
+// NewMemSessionStore returns an empty in-memory SessionStore.
+func NewMemSessionStore() *MemSessionStore {
+	return &MemSessionStore{sessions: make(map[string]*SessionState)}
+}
+
+func (s *MemSessionStore) Get(clientId string) (*SessionState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.sessions[clientId]
+	return state, ok
+}
+
+func (s *MemSessionStore) Put(state *SessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[state.ClientId] = state
+}
+
+func (s *MemSessionStore) Delete(clientId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, clientId)
+}
+
+// RetainedStore holds the single most recent retained Publish per topic.
+// Implementations must be safe for concurrent use.
+type RetainedStore interface {
+	// Get returns the retained message for topic, or ok == false if none
+	// has been retained (or it was cleared by a zero-length retained
+	// Publish).
+	Get(topic string) (msg *mqtt.Publish, ok bool)
+	// Set stores msg as the retained message for its topic, or clears
+	// any retained message for that topic if msg.Data is empty, per the
+	// MQTT retained-message semantics.
+	Set(msg *mqtt.Publish)
+	// Match returns every retained message whose topic matches filter,
+	// for delivery to a new subscription.
+	Match(filter string) []*mqtt.Publish
+}
+
+// MemRetainedStore is an in-memory RetainedStore.
+type MemRetainedStore struct {
+	mu      sync.Mutex
+	byTopic map[string]*mqtt.Publish
+}
+
+// NewMemRetainedStore returns an empty in-memory RetainedStore.
+func NewMemRetainedStore() *MemRetainedStore {
+	return &MemRetainedStore{byTopic: make(map[string]*mqtt.Publish)}
+}
+
+func (s *MemRetainedStore) Get(topic string) (*mqtt.Publish, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, ok := s.byTopic[topic]
+	return msg, ok
+}
+
+func (s *MemRetainedStore) Set(msg *mqtt.Publish) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(msg.Data) == 0 {
+		delete(s.byTopic, msg.TopicName)
+		return
+	}
+	s.byTopic[msg.TopicName] = msg
+}
+
+func (s *MemRetainedStore) Match(filter string) []*mqtt.Publish {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trie := NewSubscriptionTrie()
+	trie.Subscribe(Subscription{ClientId: "_", Filter: filter})
+
+	var matches []*mqtt.Publish
+	for topic, msg := range s.byTopic {
+		if len(trie.Match(topic)) > 0 {
+			matches = append(matches, msg)
+		}
+	}
+	return matches
+}
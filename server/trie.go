@@ -0,0 +1,124 @@
+package server
+
+import "github.com/imsbhatnagar/mqtt/topic"
+
+// SubscriptionTrie indexes subscribers by topic filter so that routing a
+// Publish to matching subscribers does not require scanning every
+// subscription. It understands the MQTT wildcards `+` (single level) and
+// `#` (remaining levels, filter-terminal only).
+//
+// SubscriptionTrie is not safe for concurrent use; callers serialize
+// access the same way Session serializes access to its own state.
+type SubscriptionTrie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	children map[string]*trieNode
+	subs     map[string]*Subscription
+}
+
+// Subscription is one client's interest in a topic filter.
+type Subscription struct {
+	ClientId string
+	Filter   string
+	Qos      QosLevel
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: make(map[string]*trieNode), subs: make(map[string]*Subscription)}
+}
+
+// NewSubscriptionTrie returns an empty trie.
+func NewSubscriptionTrie() *SubscriptionTrie {
+	return &SubscriptionTrie{root: newTrieNode()}
+}
+
+func splitTopic(t string) []string {
+	return topic.Levels(t)
+}
+
+// Subscribe records that ClientId is interested in Filter at Qos,
+// replacing any previous subscription by the same client to the same
+// filter.
+func (t *SubscriptionTrie) Subscribe(sub Subscription) {
+	node := t.root
+	for _, level := range splitTopic(sub.Filter) {
+		child, ok := node.children[level]
+		if !ok {
+			child = newTrieNode()
+			node.children[level] = child
+		}
+		node = child
+	}
+	s := sub
+	node.subs[sub.ClientId] = &s
+}
+
+// Unsubscribe removes clientId's subscription to filter, if any.
+func (t *SubscriptionTrie) Unsubscribe(clientId, filter string) {
+	node := t.root
+	for _, level := range splitTopic(filter) {
+		child, ok := node.children[level]
+		if !ok {
+			return
+		}
+		node = child
+	}
+	delete(node.subs, clientId)
+}
+
+// UnsubscribeAll removes every subscription belonging to clientId. It
+// walks the whole trie, so it is meant for the uncommon case of a client
+// disconnecting with a clean session, not the steady-state hot path.
+func (t *SubscriptionTrie) UnsubscribeAll(clientId string) {
+	var walk func(*trieNode)
+	walk = func(n *trieNode) {
+		delete(n.subs, clientId)
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(t.root)
+}
+
+// Match returns every subscription whose filter matches topic, per the
+// MQTT wildcard rules: `+` matches exactly one topic level, `#` matches
+// that level and all that follow and must be the final filter level, and
+// a `#` or `+` at the root of the filter does not match a topic whose
+// first level starts with `$` (e.g. `$SYS/...`).
+func (t *SubscriptionTrie) Match(publishedTopic string) []*Subscription {
+	levels := splitTopic(publishedTopic)
+	var matches []*Subscription
+	isSys := topic.IsSystemTopic(levels)
+
+	var walk func(n *trieNode, i int)
+	walk = func(n *trieNode, i int) {
+		if i == len(levels) {
+			for _, s := range n.subs {
+				matches = append(matches, s)
+			}
+			if child, ok := n.children["#"]; ok {
+				for _, s := range child.subs {
+					matches = append(matches, s)
+				}
+			}
+			return
+		}
+
+		if child, ok := n.children[levels[i]]; ok {
+			walk(child, i+1)
+		}
+		if child, ok := n.children["+"]; ok && !(i == 0 && isSys) {
+			walk(child, i+1)
+		}
+		if child, ok := n.children["#"]; ok && !(i == 0 && isSys) {
+			for _, s := range child.subs {
+				matches = append(matches, s)
+			}
+		}
+	}
+	walk(t.root, 0)
+
+	return matches
+}
@@ -0,0 +1,71 @@
+package server
+
+import "testing"
+
+func hasSubscriber(subs []*Subscription, clientId string) bool {
+	for _, s := range subs {
+		if s.ClientId == clientId {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSubscriptionTrieMatch(t *testing.T) {
+	trie := NewSubscriptionTrie()
+	trie.Subscribe(Subscription{ClientId: "exact", Filter: "sport/tennis/player1", Qos: 0})
+	trie.Subscribe(Subscription{ClientId: "plus", Filter: "sport/+/player1", Qos: 0})
+	trie.Subscribe(Subscription{ClientId: "hash", Filter: "sport/#", Qos: 0})
+	trie.Subscribe(Subscription{ClientId: "rootplus", Filter: "+", Qos: 0})
+
+	tests := []struct {
+		Topic string
+		Want  []string
+	}{
+		{"sport/tennis/player1", []string{"exact", "plus", "hash"}},
+		{"sport/tennis/player2", []string{"hash"}},
+		// "sport/#" must match a publish to exactly "sport" too.
+		{"sport", []string{"hash", "rootplus"}},
+		{"$SYS/uptime", nil},
+	}
+
+	for _, test := range tests {
+		got := trie.Match(test.Topic)
+		if len(got) != len(test.Want) {
+			t.Errorf("Match(%q) = %d subs, want %d", test.Topic, len(got), len(test.Want))
+			continue
+		}
+		for _, clientId := range test.Want {
+			if !hasSubscriber(got, clientId) {
+				t.Errorf("Match(%q) missing subscriber %q", test.Topic, clientId)
+			}
+		}
+	}
+}
+
+func TestSubscriptionTrieUnsubscribe(t *testing.T) {
+	trie := NewSubscriptionTrie()
+	trie.Subscribe(Subscription{ClientId: "c1", Filter: "sport/#", Qos: 0})
+
+	trie.Unsubscribe("c1", "sport/#")
+
+	if got := trie.Match("sport/tennis"); len(got) != 0 {
+		t.Errorf("Match after Unsubscribe = %v, want none", got)
+	}
+}
+
+func TestSubscriptionTrieUnsubscribeAll(t *testing.T) {
+	trie := NewSubscriptionTrie()
+	trie.Subscribe(Subscription{ClientId: "c1", Filter: "sport/tennis", Qos: 0})
+	trie.Subscribe(Subscription{ClientId: "c1", Filter: "sport/football", Qos: 0})
+	trie.Subscribe(Subscription{ClientId: "c2", Filter: "sport/tennis", Qos: 0})
+
+	trie.UnsubscribeAll("c1")
+
+	if got := trie.Match("sport/tennis"); len(got) != 1 || got[0].ClientId != "c2" {
+		t.Errorf("Match after UnsubscribeAll = %v, want only c2", got)
+	}
+	if got := trie.Match("sport/football"); len(got) != 0 {
+		t.Errorf("Match after UnsubscribeAll = %v, want none", got)
+	}
+}
@@ -0,0 +1,129 @@
+// Package topic implements MQTT topic name and topic filter matching:
+// the `+` and `#` wildcards, the `$SYS`-style exclusion of wildcarded
+// subscriptions from topics starting with `$`, and the `$share/{group}/
+// {filter}` shared-subscription naming convention.
+package topic
+
+import "strings"
+
+// Levels splits a topic name or topic filter into its `/`-separated
+// levels, the representation Matcher and other packages that index
+// filters (e.g. a subscription trie) work with directly.
+func Levels(s string) []string {
+	return strings.Split(s, "/")
+}
+
+// IsSystemTopic reports whether levels (as returned by Levels) is a
+// topic name using the `$`-prefixed convention for broker-internal
+// topics such as `$SYS/...`, which a root-level `+` or `#` must not
+// match.
+func IsSystemTopic(levels []string) bool {
+	return len(levels) > 0 && strings.HasPrefix(levels[0], "$")
+}
+
+// Filter is a subscription topic filter, e.g. "sport/tennis/+/score" or
+// "sport/#". It may contain the `+` and `#` wildcards; a plain topic name
+// (as used on a Publish) is always a valid Filter that matches only
+// itself.
+type Filter string
+
+// Match reports whether the published topic name t is matched by f,
+// applying the standard MQTT wildcard rules:
+//
+//   - `+` matches exactly one topic level.
+//   - `#` matches that level and every level after it, and is only
+//     valid as the final level of the filter.
+//   - A filter whose first level is `+` or `#` does not match a topic
+//     whose first level begins with `$` (the convention used for
+//     broker-internal topics such as `$SYS/...`).
+//
+// Match recompiles f on every call; a caller matching the same filter
+// against many topics should use Compile instead.
+func (f Filter) Match(t string) bool {
+	return Compile(f).Match(t)
+}
+
+// Valid reports whether f is syntactically well-formed: `#` may only
+// appear as, and occupy the whole of, the final level, and `+` may only
+// appear as, and occupy the whole of, a level. Plain topic names (used
+// for validating a Publish's TopicName, which may not itself contain
+// wildcards at all) should additionally reject any `+` or `#`; Valid
+// alone does not distinguish the two uses.
+func (f Filter) Valid() bool {
+	if f == "" {
+		return false
+	}
+	levels := Levels(string(f))
+	for i, level := range levels {
+		switch {
+		case level == "+":
+			continue
+		case level == "#":
+			if i != len(levels)-1 {
+				return false
+			}
+		case strings.ContainsAny(level, "+#"):
+			return false
+		}
+	}
+	return true
+}
+
+// Matcher is a Filter compiled into its topic levels, for efficient
+// repeated matching against many topic names.
+type Matcher struct {
+	levels []string
+}
+
+// Compile compiles f for repeated use with Match. Compile does not
+// validate f; an invalid Filter compiles without error but may not match
+// the way the caller expects.
+func Compile(f Filter) *Matcher {
+	return &Matcher{levels: Levels(string(f))}
+}
+
+// Match reports whether the published topic name t matches the compiled
+// filter, using the same rules as Filter.Match.
+func (m *Matcher) Match(t string) bool {
+	topicLevels := Levels(t)
+	isSys := IsSystemTopic(topicLevels)
+
+	for i, level := range m.levels {
+		if level == "#" {
+			return !(i == 0 && isSys)
+		}
+
+		if i >= len(topicLevels) {
+			return false
+		}
+
+		if level == "+" {
+			if i == 0 && isSys {
+				return false
+			}
+			continue
+		}
+
+		if level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(m.levels) == len(topicLevels)
+}
+
+// SharedPrefix is the first filter level that marks a shared
+// subscription, as in "$share/{group}/{filter}".
+const SharedPrefix = "$share"
+
+// ParseShared splits a "$share/{group}/{filter}" subscription filter
+// into its group name and the underlying filter. ok is false, and group
+// and filter are unspecified, if sharedFilter does not use the shared-
+// subscription convention.
+func ParseShared(sharedFilter string) (group, filter string, ok bool) {
+	parts := strings.SplitN(sharedFilter, "/", 3)
+	if len(parts) != 3 || parts[0] != SharedPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
@@ -0,0 +1,61 @@
+package topic
+
+import "testing"
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		Filter Filter
+		Topic  string
+		Want   bool
+	}{
+		{"sport/tennis/player1", "sport/tennis/player1", true},
+		{"sport/tennis/player1", "sport/tennis/player2", false},
+		{"sport/tennis/+", "sport/tennis/player1", true},
+		{"sport/tennis/+", "sport/tennis/player1/ranking", false},
+		{"sport/#", "sport", true},
+		{"sport/#", "sport/tennis", true},
+		{"sport/#", "sport/tennis/player1", true},
+		{"+/tennis/#", "sport/tennis/player1", true},
+		{"+", "$SYS/uptime", false},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+
+	for _, test := range tests {
+		if got := test.Filter.Match(test.Topic); got != test.Want {
+			t.Errorf("Filter(%q).Match(%q) = %v, want %v", test.Filter, test.Topic, got, test.Want)
+		}
+	}
+}
+
+func TestFilterValid(t *testing.T) {
+	tests := []struct {
+		Filter Filter
+		Want   bool
+	}{
+		{"sport/tennis/player1", true},
+		{"sport/+/player1", true},
+		{"sport/#", true},
+		{"sport/tennis#", false},
+		{"sport/tennis/#/ranking", false},
+		{"sport/+tennis", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := test.Filter.Valid(); got != test.Want {
+			t.Errorf("Filter(%q).Valid() = %v, want %v", test.Filter, got, test.Want)
+		}
+	}
+}
+
+func TestParseShared(t *testing.T) {
+	group, filter, ok := ParseShared("$share/consumers/sport/tennis/+")
+	if !ok || group != "consumers" || filter != "sport/tennis/+" {
+		t.Errorf("ParseShared = (%q, %q, %v), want (\"consumers\", \"sport/tennis/+\", true)", group, filter, ok)
+	}
+
+	if _, _, ok := ParseShared("sport/tennis/+"); ok {
+		t.Errorf("ParseShared of a non-shared filter returned ok=true")
+	}
+}
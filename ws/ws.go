@@ -0,0 +1,108 @@
+// Package ws adapts a WebSocket connection into a net.Conn so the mqtt
+// codec's Encode/DecodeRead can be used unmodified over MQTT-over-
+// WebSockets, as used by browsers and by proxies that only forward HTTP.
+package ws
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocols are the WebSocket subprotocol names this package
+// negotiates, in preference order, per the MQTT-over-WebSockets
+// convention (the plain "mqtt" name for MQTT 3.1.1/5, "mqttv3.1" for the
+// older 3.1 wire format).
+var Subprotocols = []string{"mqtt", "mqttv3.1"}
+
+var errTextFrame = errors.New("mqtt/ws: received a text frame, expected binary")
+
+// Conn adapts a *websocket.Conn, which is message- (frame-) oriented,
+// into the byte-stream io.ReadWriteCloser (and full net.Conn) that
+// Encode/DecodeRead expect. MQTT packet boundaries do not necessarily
+// align with WebSocket frame boundaries in either direction: a Read may
+// need to span more than one incoming frame to satisfy the caller, and
+// one Encode call, which issues several Writes, goes out as several
+// frames, so Conn never assumes one frame == one packet.
+type Conn struct {
+	ws  *websocket.Conn
+	buf bytes.Buffer
+}
+
+// NewConn wraps ws as a net.Conn. ws must have been negotiated (or will
+// be used) for binary-frame traffic only; a text frame is a protocol
+// error and causes Read to fail.
+func NewConn(ws *websocket.Conn) net.Conn {
+	return &Conn{ws: ws}
+}
+
+// Handler upgrades each incoming HTTP request to a WebSocket connection
+// negotiating Subprotocols, and invokes handle with the resulting
+// net.Conn. It is meant to be registered directly as an http.Handler, or
+// wrapped if the caller needs additional request validation first.
+func Handler(handle func(net.Conn)) http.Handler {
+	upgrader := websocket.Upgrader{
+		Subprotocols:    Subprotocols,
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		handle(NewConn(wsConn))
+	})
+}
+
+// Read implements io.Reader by coalescing WebSocket frames: if a previous
+// frame left unread bytes buffered, those are served first; otherwise it
+// blocks for the next frame. A text frame is a protocol violation and is
+// reported as an error rather than being delivered to the caller.
+func (c *Conn) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		msgType, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		if msgType != websocket.BinaryMessage {
+			return 0, errTextFrame
+		}
+		c.buf.Write(data)
+	}
+	return c.buf.Read(p)
+}
+
+// Write implements io.Writer by sending p as a single binary WebSocket
+// frame. The codec's Encode methods write a packet's fixed header and
+// the rest of the packet in separate Write calls, so one MQTT packet is
+// sent as more than one frame; splitting a packet across frames is valid
+// on the wire, and Read on the other side reassembles it.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *Conn) LocalAddr() net.Addr  { return c.ws.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr { return c.ws.RemoteAddr() }
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }